@@ -152,7 +152,10 @@ func (fsac *FSAC) Encrypt(MPK *MPK, Mes string, policy string) (*FSACCiphertext,
 	//Generate the ABE ciphertext
 	k, _ := sampler.Sample()
 	K := new(bn256.GT).ScalarBaseMult(k)
-	ct := SymEnc.XOREncryptDecrypt([]byte(Mes), SymEnc.KDF(K))
+	ct, err := SymEnc.Seal(K, SymEnc.AES256GCM, []byte(Mes), nil)
+	if err != nil {
+		return nil, err
+	}
 	fmt.Printf("CT=%v\n", string(ct))
 
 	s, _ := sampler.Sample()
@@ -226,7 +229,11 @@ func (fsac *FSAC) Santize(MPK *MPK, Key *Key, CT *FSACCiphertext) ([]byte, *VKey
 	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
 	_k, _ := sampler.Sample()
 	_K := new(bn256.GT).ScalarBaseMult(_k)
-	sanCT := SymEnc.XOREncryptDecrypt(CT.CT, SymEnc.KDF(_K))
+	//The sanitizer's layer wraps the encryptor's, so it is removed first
+	sanCT, err := SymEnc.Seal(_K, SymEnc.AES256GCM, CT.CT, nil)
+	if err != nil {
+		return nil, nil, err
+	}
 	b, _ := sampler.Sample()
 	v0 := new(bn256.GT).ScalarBaseMult(b)
 	v1 := new(bn256.GT).Add(_K, new(bn256.GT).ScalarMult(Key.PK, b))
@@ -253,7 +260,13 @@ func (fsac *FSAC) Decrypt(MPK *MPK, CT *FSACCiphertext, SK *SK, VKey *VKey, Key
 	A = new(bn256.GT).Add(bn256.Pair(SK.K, CT._C), new(bn256.GT).Neg(A))
 	K := new(bn256.GT).Add(CT.C, new(bn256.GT).Neg(A))
 	_K := new(bn256.GT).Add(VKey.V1, new(bn256.GT).Neg(new(bn256.GT).ScalarMult(VKey.V0, Key.SK)))
-	temp := SymEnc.XOREncryptDecrypt(ct, SymEnc.KDF(K))
-	_Mes := SymEnc.XOREncryptDecrypt(temp, SymEnc.KDF(_K))
+	temp, err := SymEnc.Open(_K, ct, nil)
+	if err != nil {
+		return "", err
+	}
+	_Mes, err := SymEnc.Open(K, temp, nil)
+	if err != nil {
+		return "", err
+	}
 	return string(_Mes), nil
 }
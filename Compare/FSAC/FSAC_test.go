@@ -51,5 +51,11 @@ func TestAll(t *testing.T) {
 
 	//Decrypt
 	recoverMes, err := fsac.Decrypt(MPK, CT, SK, VKey, Key, ctSan)
-	fmt.Printf("recoverMes=%v\n", recoverMes)
+	require.NoError(t, err)
+	require.Equal(t, Mes, recoverMes)
+
+	//A modified sanitized ciphertext is rejected
+	ctSan[len(ctSan)-1] ^= 1
+	_, err = fsac.Decrypt(MPK, CT, SK, VKey, Key, ctSan)
+	require.Error(t, err)
 }
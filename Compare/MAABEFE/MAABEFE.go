@@ -277,11 +277,14 @@ func Encrypt(pp *PP, m *big.Int, msg string, msp *abe.MSP, pkSet []*AuthPK) (*Ci
 	if len(msg) == 0 {
 		return nil, nil, fmt.Errorf("message cannot be empty")
 	}
-	// msg is encrypted with AES-CBC with a random key that is encrypted with
+	// msg is encrypted with AES-GCM with a random key that is encrypted with
 	// MA-ABE
 	// generate secret key
 	symKey := new(bn256.GT).ScalarBaseMult(m)
-	ciphertext := SymEnc.XOREncryptDecrypt([]byte(msg), SymEnc.KDF(symKey))
+	ciphertext, err := SymEnc.Seal(symKey, SymEnc.AES256GCM, []byte(msg), nil)
+	if err != nil {
+		return nil, nil, err
+	}
 	// now encrypt symKey with MA-ABE
 	// rand generator
 
@@ -640,7 +643,9 @@ func Decrypt(pp *PP, ct *Cipher, akSet []*AttrKey) (string, error) {
 	}
 	// calculate key for symmetric encryption
 	symKey := new(bn256.GT).Add(bn256.Pair(ct.CM.C0, pp.G2), new(bn256.GT).Neg(eggs))
-	msg := SymEnc.XOREncryptDecrypt(ct.Ciphertext, SymEnc.KDF(symKey))
-	fmt.Println(string(msg))
+	msg, err := SymEnc.Open(symKey, ct.Ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
 	return string(msg), nil
 }
@@ -1,12 +1,9 @@
 package MAABEFE
 
 import (
-	"crypto/rand"
 	"fmt"
 	"testing"
 
-	"github.com/WXY1313/Trade/Crypto/SymEnc"
-	"github.com/fentec-project/bn256"
 	"github.com/fentec-project/gofe/abe"
 	"github.com/fentec-project/gofe/sample"
 	"github.com/stretchr/testify/assert"
@@ -14,8 +11,6 @@ import (
 
 func TestMAABEFE(t *testing.T) {
 	// create new MAABE struct with Global Parameters
-	_, gt, _ := bn256.RandomGT(rand.Reader)
-	SymEnc.KDF(gt)
 	pp := GlobalSetup()
 
 	// create three authorities, each with two attributes
@@ -23,19 +23,59 @@ func Min(a, b int) int {
 	return b
 }
 
+// Leaf labels with a fixed meaning in a trade tree. Every other label names a
+// key leaf whose share is encrypted to a public key supplied to Encrypt and is
+// released to a buyer with ReKeyGen, e.g. escrow, auditor or co-sellers.
+const (
+	LabelBuyer = "buyer" // share under the CP-ABE buying policy
+	LabelPer   = "per"   // key leaf of the seller, for pay-per-use trades
+	LabelSub   = "sub"   // share for the seller's subscribers
+)
+
 type DTCiphertext struct {
 	Policy string
+	Trade  *LSSS.Node
 	Com    *bn256.G1
-	C1     *CPABE.ABECiphertext
-	C2     *bn256.G1
-	C2Com  *bn256.G1
-	C3     *Sub.SubCiphertext
+	C1     *CPABE.ABECiphertext // nil if Trade has no buyer leaf
+	C2     map[string]*bn256.G1 // C2[x] = pk_x^λx for every key leaf x
+	C2Com  map[string]*bn256.G1 // C2Com[x] = g1^λx
+	C3     *Sub.SubCiphertext   // nil if Trade has no sub leaf
+	Proof  *SharesProof         // the shares behind Com, C1, C2 and C3 agree
+	CCA    bool                 // C1 and C3 are in CCA mode, see EncryptCCA
+}
+
+// AD returns the associated data to seal the trading message under the key
+// of CT. It binds Com rather than Policy, which UpdatePolicy rewrites.
+func (CT *DTCiphertext) AD() []byte {
+	return CT.Com.Marshal()
 }
 
 type ReKey struct {
-	D1 *bn256.G1
-	D2 *bn256.G1
-	D3 *bn256.G1
+	D1    *bn256.G1
+	D2    *bn256.G1
+	D3    *bn256.G1
+	Proof *ReKeyProof
+}
+
+// DecKeys are the credentials a buyer holds for the leaves of a trade tree;
+// unused fields may be nil.
+type DecKeys struct {
+	AK     *CPABE.SK
+	SubKey *Sub.SubKey
+	ReKeys map[string]*ReKey
+	SKU    *big.Int
+}
+
+// DefaultTrade is the trade tree 2-of-(P_buyer,1-of-(P_per,P_sub)).
+func DefaultTrade() *LSSS.Node {
+	root := LSSS.NewNode(false, 2, 2, big.NewInt(int64(0)))
+	P_buyer := LSSS.NewLeaf(LabelBuyer, big.NewInt(int64(1)))
+	P_pay := LSSS.NewNode(false, 2, 1, big.NewInt(int64(2)))
+	root.Children = []*LSSS.Node{P_buyer, P_pay}
+	P_per := LSSS.NewLeaf(LabelPer, big.NewInt(int64(1)))
+	P_sub := LSSS.NewLeaf(LabelSub, big.NewInt(int64(2)))
+	P_pay.Children = []*LSSS.Node{P_per, P_sub}
+	return root
 }
 
 func Setup() (*CPABE.MPK, *CPABE.MSK, *Sub.SPK, *Sub.SSK) {
@@ -47,128 +87,362 @@ func Setup() (*CPABE.MPK, *CPABE.MSK, *Sub.SPK, *Sub.SSK) {
 	return MPK, MSK, SPK, SSK
 }
 
-func AKGen(MPK *CPABE.MPK, MSK *CPABE.MSK, su []string) *CPABE.SK {
-	AK, _ := CPABE.KeyGen(MPK, MSK, su)
-	return AK
+// AKGen issues the buyer's attribute key and checks it with CPABE.KeyCheck,
+// as the buyer would before paying for a trade.
+func AKGen(MPK *CPABE.MPK, MSK *CPABE.MSK, su []string) (*CPABE.SK, error) {
+	AK, err := CPABE.KeyGen(MPK, MSK, su)
+	if err != nil {
+		return nil, err
+	}
+	if !CPABE.KeyCheck(MPK, AK) {
+		return nil, fmt.Errorf("attribute key failed the key check")
+	}
+	return AK, nil
 }
 
-func Encrypt(MPK *CPABE.MPK, SPK *Sub.SPK, policy string, s *big.Int, pko *bn256.G1) (*DTCiphertext, [][]*big.Int) {
-	//1.Construct the Trade policy:\tau_{trade}=2-of-(1-of-(P_seller,P_sub),P_buyer))
-	root := LSSS.NewNode(false, 2, 2, big.NewInt(int64(0)))
-	P_buyer := LSSS.NewNode(true, 0, 1, big.NewInt(int64(1)))
-	P_pay := LSSS.NewNode(false, 2, 1, big.NewInt(int64(2)))
-	root.Children = []*LSSS.Node{P_buyer, P_pay}
-	P_per := LSSS.NewNode(true, 0, 1, big.NewInt(int64(1)))
-	P_sub := LSSS.NewNode(true, 0, 1, big.NewInt(int64(2)))
-	P_pay.Children = []*LSSS.Node{P_per, P_sub}
-	matrix := LSSS.Convert(root)
-
-	// sum := new(bn256.G1).Add(new(bn256.G1).ScalarBaseMult(big.NewInt(1)), new(bn256.G1).ScalarBaseMult(verResult[0][0]))
-	// fmt.Printf("VerResult=%v\n", sum)
-
-	com := new(bn256.G1).ScalarMult(MPK.G1, s)
-	shares, _ := LSSS.LSSSShare(s, matrix)
-	fmt.Printf("Shares=%v\n", shares)
-	//Generate P_buyer ciphertext C1
-	ABECT, _ := CPABE.Encrypt(MPK, shares[0], policy)
-	//Generate P_per ciphertext C2
-	c2Com := new(bn256.G1).ScalarMult(MPK.G1, shares[1])
-	c2 := new(bn256.G1).ScalarMult(pko, shares[1])
-	//Generate P_sub ciphertext C3
-	SubCT, _ := Sub.Encrypt(SPK, shares[2])
-
-	return &DTCiphertext{Policy: policy,
-		Com:   com,
-		C1:    ABECT,
-		C2:    c2,
-		C2Com: c2Com,
-		C3:    SubCT}, matrix
-}
-
-func EncVer(MPK *CPABE.MPK, SPK *Sub.SPK, CT *DTCiphertext, matrix [][]*big.Int, pko *bn256.G1) bool {
-	if !CPABE.CipherCheck(MPK, CT.C1) {
-		return false
+// Encrypt shares s over the trade tree; the subscription share, if any, is
+// bound to epoch.
+func Encrypt(MPK *CPABE.MPK, SPK *Sub.SPK, trade *LSSS.Node, policy string, epoch uint64, s *big.Int, pks map[string]*bn256.G1) (*DTCiphertext, error) {
+	CT, err := encrypt(MPK, SPK, trade, epoch, s, pks, false, func(m *big.Int) (*CPABE.ABECiphertext, error) {
+		return CPABE.Encrypt(MPK, m, policy)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if !Sub.CipherCheck(SPK, CT.C3) {
-		return false
+	CT.Policy = policy
+	return CT, nil
+}
+
+// EncryptUpdatable is Encrypt that also returns the seller's state for
+// UpdatePolicyKeyGen. The state must stay with the seller.
+func EncryptUpdatable(MPK *CPABE.MPK, SPK *Sub.SPK, trade *LSSS.Node, policy string, epoch uint64, s *big.Int, pks map[string]*bn256.G1) (*DTCiphertext, *CPABE.UpdateState, error) {
+	var state *CPABE.UpdateState
+	CT, err := encrypt(MPK, SPK, trade, epoch, s, pks, false, func(m *big.Int) (*CPABE.ABECiphertext, error) {
+		ct, st, err := CPABE.EncryptUpdatable(MPK, m, policy)
+		state = st
+		return ct, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	CT.Policy = policy
+	return CT, state, nil
+}
+
+// EncryptCCA is Encrypt with C1 and C3 in CCA mode: Decrypt then reports an
+// error on a tampered buyer or sub ciphertext instead of returning a wrong
+// key. The mode is bound by the shares proof, so it cannot be stripped.
+func EncryptCCA(MPK *CPABE.MPK, SPK *Sub.SPK, trade *LSSS.Node, policy string, epoch uint64, s *big.Int, pks map[string]*bn256.G1) (*DTCiphertext, error) {
+	CT, err := encrypt(MPK, SPK, trade, epoch, s, pks, true, func(m *big.Int) (*CPABE.ABECiphertext, error) {
+		return CPABE.EncryptCCA(MPK, m, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	CT.Policy = policy
+	return CT, nil
+}
+
+// encrypt builds a DTCiphertext whose buyer share is encrypted by buyer. The
+// shares proof only depends on C1.Com.
+func encrypt(MPK *CPABE.MPK, SPK *Sub.SPK, trade *LSSS.Node, epoch uint64, s *big.Int, pks map[string]*bn256.G1, cca bool, buyer func(m *big.Int) (*CPABE.ABECiphertext, error)) (*DTCiphertext, error) {
+	if err := LSSS.CheckTree(trade); err != nil {
+		return nil, err
+	}
+	matrix := LSSS.Convert(trade)
+	//λ = M·v with v[0] = s, v is kept for the shares proof
+	v := make([]*big.Int, len(matrix[0]))
+	v[0] = new(big.Int).Mod(s, bn256.Order)
+	for j := 1; j < len(v); j++ {
+		v[j], _ = rand.Int(rand.Reader, bn256.Order)
+	}
+	shares := make([]*big.Int, len(matrix))
+	for i := range matrix {
+		shares[i] = rowDot(matrix[i], v)
+	}
+	var err error
+	CT := &DTCiphertext{Trade: trade,
+		Com:   new(bn256.G1).ScalarMult(MPK.G1, s),
+		C2:    make(map[string]*bn256.G1),
+		C2Com: make(map[string]*bn256.G1),
+		CCA:   cca}
+	for i, leaf := range LSSS.Leaves(trade) {
+		switch leaf.Label {
+		case LabelBuyer:
+			//Generate P_buyer ciphertext C1
+			CT.C1, err = buyer(shares[i])
+			if err != nil {
+				return nil, err
+			}
+		case LabelSub:
+			//Generate P_sub ciphertext C3
+			if cca {
+				CT.C3, err = Sub.EncryptCCA(SPK, shares[i], epoch)
+			} else {
+				CT.C3, err = Sub.Encrypt(SPK, shares[i], epoch)
+			}
+			if err != nil {
+				return nil, err
+			}
+		default:
+			//Generate key leaf ciphertext C2
+			pk, ok := pks[leaf.Label]
+			if !ok {
+				return nil, fmt.Errorf("no public key for trade leaf %s", leaf.Label)
+			}
+			CT.C2Com[leaf.Label] = new(bn256.G1).ScalarMult(MPK.G1, shares[i])
+			CT.C2[leaf.Label] = new(bn256.G1).ScalarMult(pk, shares[i])
+		}
+	}
+	CT.Proof = proveShares(MPK, CT, matrix, v, pks)
+	return CT, nil
+}
+
+// UpdatePolicyKeyGen lets the seller who encrypted CT move it to a new buying
+// policy from its state. The shares proof does not cover the policy, so it
+// stays valid.
+func UpdatePolicyKeyGen(MPK *CPABE.MPK, CT *DTCiphertext, state *CPABE.UpdateState, policy string) (*CPABE.PolicyUpdateKey, *CPABE.UpdateState, error) {
+	if CT.C1 == nil {
+		return nil, nil, fmt.Errorf("trade tree has no buyer leaf")
+	}
+	return CPABE.UpdatePolicyKeyGen(MPK, CT.C1, state, policy)
+}
+
+// UpdatePolicy applies a policy update key to a stored DT ciphertext.
+func UpdatePolicy(CT *DTCiphertext, uk *CPABE.PolicyUpdateKey) error {
+	if CT.C1 == nil {
+		return fmt.Errorf("trade tree has no buyer leaf")
+	}
+	if err := CPABE.UpdatePolicy(CT.C1, uk); err != nil {
+		return err
 	}
+	CT.Policy = uk.Policy
+	return nil
+}
 
-	var shareCom []*bn256.G1
-	shareCom = append(shareCom, CT.C1.Com, CT.C2Com, CT.C3.Com)
+// shareComs returns the commitments g1^λi in the row order of the trade
+// matrix, or nil if the components of CT do not match its leaves.
+func shareComs(CT *DTCiphertext) []*bn256.G1 {
+	if LSSS.CheckTree(CT.Trade) != nil {
+		return nil
+	}
+	var coms []*bn256.G1
+	keyLeaves := 0
+	for _, leaf := range LSSS.Leaves(CT.Trade) {
+		var com *bn256.G1
+		switch leaf.Label {
+		case LabelBuyer:
+			if CT.C1 != nil {
+				com = CT.C1.Com
+			}
+		case LabelSub:
+			if CT.C3 != nil {
+				com = CT.C3.Com
+			}
+		default:
+			if CT.C2[leaf.Label] != nil {
+				com = CT.C2Com[leaf.Label]
+			}
+			keyLeaves++
+		}
+		if com == nil {
+			return nil
+		}
+		coms = append(coms, com)
+	}
+	if len(CT.C2) != keyLeaves || len(CT.C2Com) != keyLeaves {
+		return nil
+	}
+	return coms
+}
 
-	I1 := make([]int, 2)
-	I1[0] = 0
-	I1[1] = 1
-	rows := len(I1)
-	recMatrix := make([][]*big.Int, rows)
-	for i := 0; i < rows; i++ {
-		recMatrix[i] = matrix[I1[i]][:rows]
+// EncVer checks the component ciphertexts and the shares proof of CT, where
+// pks are the public keys of its key leaves.
+func EncVer(MPK *CPABE.MPK, SPK *Sub.SPK, CT *DTCiphertext, pks map[string]*bn256.G1) bool {
+	shareCom := shareComs(CT)
+	if shareCom == nil {
+		return false
 	}
-	invRecMatrix, _ := LSSS.GaussJordanInverse(recMatrix)
-	isShareValid, _ := LSSS.GrpLSSSReconG1(invRecMatrix, shareCom, I1)
-	if !Operation.G1Equal(isShareValid, CT.Com) {
+	if !verifyShares(MPK, CT, pks) {
 		return false
 	}
-	I2 := make([]int, 2)
-	I2[0] = 0
-	I2[1] = 1
-	rows = len(I2)
-	recMatrix = make([][]*big.Int, rows)
-	for i := 0; i < rows; i++ {
-		recMatrix[i] = matrix[I2[i]][:rows]
-	}
-	invRecMatrix, _ = LSSS.GaussJordanInverse(recMatrix)
-	isShareValid, _ = LSSS.GrpLSSSReconG1(invRecMatrix, shareCom, I2)
-	if !Operation.G1Equal(isShareValid, CT.Com) {
+	if CT.C1 != nil && !CPABE.CipherCheck(MPK, CT.C1) {
 		return false
 	}
-	return true
+	if CT.C3 != nil && !Sub.CipherCheck(SPK, CT.C3) {
+		return false
+	}
+	//The commitments must be a sharing of some secret: H·(g1^λ) = 0 for the
+	//parity matrix H of the trade matrix
+	matrix := LSSS.Convert(CT.Trade)
+	zero := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for _, h := range LSSS.GenerateParityMatrix(matrix, bn256.Order) {
+		if !Operation.G1Equal(reconG1(shareCom, h), zero) {
+			return false
+		}
+	}
+	//and that secret must be the one committed in Com
+	all := make(map[string]bool)
+	for _, leaf := range LSSS.Leaves(CT.Trade) {
+		all[leaf.Label] = true
+	}
+	I, err := LSSS.AuthorizedRows(CT.Trade, all)
+	if err != nil {
+		return false
+	}
+	w, err := LSSS.ReconCoeffs(matrix, I, bn256.Order)
+	if err != nil {
+		return false
+	}
+	rowCom := make([]*bn256.G1, len(I))
+	for k, i := range I {
+		rowCom[k] = shareCom[i]
+	}
+	return Operation.G1Equal(reconG1(rowCom, w), CT.Com)
+}
+
+func reconG1(points []*bn256.G1, w []*big.Int) *bn256.G1 {
+	sum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for i, x := range w {
+		e := new(big.Int).Mod(x, bn256.Order)
+		sum.Add(sum, new(bn256.G1).ScalarMult(points[i], e))
+	}
+	return sum
 }
 
-func ReKeyGen(MPK *CPABE.MPK, CT *DTCiphertext, sko *big.Int, pko, pku *bn256.G1) *ReKey {
+// ReKeyGen lets the holder of the key leaf label (the seller for LabelPer)
+// release its share to the buyer with public key pku.
+func ReKeyGen(MPK *CPABE.MPK, CT *DTCiphertext, label string, sko *big.Int, pko, pku *bn256.G1) (*ReKey, error) {
+	c2, ok := CT.C2[label]
+	if !ok {
+		return nil, fmt.Errorf("no key leaf %s in the trade tree", label)
+	}
 	r, _ := rand.Int(rand.Reader, bn256.Order)
 	d1 := new(bn256.G1).ScalarMult(MPK.G1, r)
 	d2 := new(bn256.G1).ScalarMult(pko, r)
 	skoInv := new(big.Int).ModInverse(sko, bn256.Order)
 	skoInv = skoInv.Mod(skoInv, bn256.Order)
-	d3 := new(bn256.G1).ScalarMult(CT.C2, skoInv)
+	d3 := new(bn256.G1).ScalarMult(c2, skoInv)
 	d3 = d3.Add(d3, new(bn256.G1).ScalarMult(pku, r))
-	return &ReKey{D1: d1, D2: d2, D3: d3}
+	rekey := &ReKey{D1: d1, D2: d2, D3: d3}
+	rekey.Proof = proveReKey(MPK, label, c2, pko, pku, rekey, r, skoInv)
+	return rekey, nil
 }
 
-func ReKeyVer(MPK *CPABE.MPK, CT *DTCiphertext, rekey *ReKey, vko, vku *bn256.G2) bool {
+func ReKeyVer(MPK *CPABE.MPK, CT *DTCiphertext, label string, rekey *ReKey, vko, vku *bn256.G2) bool {
+	c2, ok := CT.C2[label]
+	if !ok {
+		return false
+	}
 	if !Operation.GTEqual(bn256.Pair(rekey.D2, MPK.G2), bn256.Pair(rekey.D1, vko)) {
 		return false
 	}
-	if !Operation.GTEqual(bn256.Pair(rekey.D3, vko), new(bn256.GT).Add(bn256.Pair(CT.C2, MPK.H2), bn256.Pair(rekey.D2, vku))) {
+	if !Operation.GTEqual(bn256.Pair(rekey.D3, vko), new(bn256.GT).Add(bn256.Pair(c2, MPK.H2), bn256.Pair(rekey.D2, vku))) {
 		return false
 	}
 	return true
 }
 
-func PerDecrypt(MPK *CPABE.MPK, CT *DTCiphertext, matrix [][]*big.Int, rekey *ReKey, sku *big.Int, AK *CPABE.SK) *bn256.GT {
-	decShare := make([]*bn256.GT, 2)
-	decShare[0], _ = CPABE.Decrypt(MPK, CT.C1, AK)
-	tempLeft := new(bn256.G1).ScalarMult(rekey.D1, sku)
-	tempLeft = tempLeft.Add(rekey.D3, new(bn256.G1).Neg(tempLeft))
-	decShare[1] = bn256.Pair(tempLeft, MPK.U2)
+// ReKeyCheck verifies the proof carried by rekey against the registered G1
+// keys only, so a party without pairings (e.g. an arbiter contract) can decide
+// whether the seller released a correct key for the key leaf label.
+func ReKeyCheck(MPK *CPABE.MPK, CT *DTCiphertext, label string, rekey *ReKey, pko, pku *bn256.G1) bool {
+	c2, ok := CT.C2[label]
+	if !ok {
+		return false
+	}
+	return verifyReKey(MPK, label, c2, pko, pku, rekey)
+}
 
-	I := make([]int, 2)
-	I[0] = 0
-	I[1] = 1
-	rows := len(I)
-	recMatrix := make([][]*big.Int, rows)
-	for i := 0; i < rows; i++ {
-		recMatrix[i] = matrix[I[i]][:rows]
+// Decrypt recovers e(h1,u2)^s from the leaves keys can open, choosing the
+// authorized set of the trade tree that takes the fewest pairings.
+func Decrypt(MPK *CPABE.MPK, SPK *Sub.SPK, CT *DTCiphertext, keys *DecKeys) (*bn256.GT, error) {
+	if err := LSSS.CheckTree(CT.Trade); err != nil {
+		return nil, err
+	}
+	leaves := LSSS.Leaves(CT.Trade)
+	have := make(map[string]bool)
+	for _, leaf := range leaves {
+		switch leaf.Label {
+		case LabelBuyer:
+			have[leaf.Label] = keys.AK != nil && CT.C1 != nil && CPABE.Match(CT.C1, keys.AK)
+		case LabelSub:
+			have[leaf.Label] = keys.SubKey != nil && CT.C3 != nil && keys.SKU != nil
+		default:
+			have[leaf.Label] = keys.ReKeys[leaf.Label] != nil && CT.C2[leaf.Label] != nil && keys.SKU != nil
+		}
+	}
+	I, err := LSSS.CheapestRows(CT.Trade, have, func(label string) int { return decryptCost(CT, keys, label) })
+	if err != nil {
+		return nil, err
+	}
+	w, err := LSSS.ReconCoeffs(LSSS.Convert(CT.Trade), I, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	S := new(bn256.GT).ScalarBaseMult(big.NewInt(0))
+	for k, i := range I {
+		var decShare *bn256.GT
+		switch label := leaves[i].Label; label {
+		case LabelBuyer:
+			if CT.CCA {
+				decShare, err = CPABE.DecryptCCA(MPK, CT.C1, keys.AK)
+			} else {
+				decShare, err = CPABE.Decrypt(MPK, CT.C1, keys.AK)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case LabelSub:
+			if CT.CCA {
+				decShare, err = Sub.DecryptCCA(SPK, CT.C3, keys.SubKey, keys.SKU)
+			} else {
+				decShare, err = Sub.Decrypt(SPK, CT.C3, keys.SubKey, keys.SKU)
+			}
+			if err != nil {
+				return nil, err
+			}
+		default:
+			rekey := keys.ReKeys[label]
+			tempLeft := new(bn256.G1).ScalarMult(rekey.D1, keys.SKU)
+			tempLeft = tempLeft.Add(rekey.D3, new(bn256.G1).Neg(tempLeft))
+			decShare = bn256.Pair(tempLeft, MPK.U2)
+		}
+		S.Add(S, new(bn256.GT).ScalarMult(decShare, w[k]))
 	}
-	invRecMatrix, _ := LSSS.GaussJordanInverse(recMatrix)
-	S, _ := LSSS.GrpLSSSReconGT(invRecMatrix, decShare, I)
-	return S
+	return S, nil
 }
 
-func SubKeyGen(SPK *Sub.SPK, SSK *Sub.SSK, pku *bn256.G1) *Sub.SubKey {
-	SK, _ := Sub.KeyGen(SPK, SSK, pku)
-	return SK
+// decryptCost is the number of pairings Decrypt spends on the leaf label,
+// so that it opens the cheapest authorized set of leaves.
+func decryptCost(CT *DTCiphertext, keys *DecKeys, label string) int {
+	switch label {
+	case LabelBuyer:
+		//e(C,u2), e(K,CA+T·_C) and two per attribute row of the key
+		rows := 0
+		for _, at := range CT.C1.MSP.RowToAttrib {
+			if keys.AK.KXs[at] != nil {
+				rows++
+			}
+		}
+		return 2 + 2*rows
+	case LabelSub:
+		//the revocation part and the epoch part
+		return 5
+	default:
+		return 1
+	}
+}
+
+// PerDecrypt decrypts CT with the buyer's attribute key and the re-encryption
+// keys released for the key leaves of the trade tree.
+func PerDecrypt(MPK *CPABE.MPK, CT *DTCiphertext, rekeys map[string]*ReKey, sku *big.Int, AK *CPABE.SK) (*bn256.GT, error) {
+	return Decrypt(MPK, nil, CT, &DecKeys{AK: AK, ReKeys: rekeys, SKU: sku})
+}
+
+// SubKeyGen issues a subscription for the epochs start to end inclusive.
+func SubKeyGen(SPK *Sub.SPK, SSK *Sub.SSK, pku *bn256.G1, start, end uint64) (*Sub.SubKey, error) {
+	return Sub.KeyGen(SPK, SSK, pku, start, end)
 }
 
 func SubKeyVer(SPK *Sub.SPK, SK *Sub.SubKey, vku *bn256.G2) bool {
@@ -176,20 +450,19 @@ func SubKeyVer(SPK *Sub.SPK, SK *Sub.SubKey, vku *bn256.G2) bool {
 	return KeyValid
 }
 
-func SubDecrypt(MPK *CPABE.MPK, SPK *Sub.SPK, CT *DTCiphertext, matrix [][]*big.Int, SK *Sub.SubKey, sku *big.Int, AK *CPABE.SK) *bn256.GT {
-	decShare := make([]*bn256.GT, 2)
-	decShare[0], _ = CPABE.Decrypt(MPK, CT.C1, AK)
-	decShare[1], _ = Sub.Decrypt(SPK, CT.C3, SK, sku)
+// BuyerMatch tells whether the attribute key AK satisfies the buying policy of
+// CT without any pairing, also when the policy is hidden with CPABE.HidePolicy.
+func BuyerMatch(CT *DTCiphertext, AK *CPABE.SK) bool {
+	return CT.C1 != nil && CPABE.Match(CT.C1, AK)
+}
 
-	I := make([]int, 2)
-	I[0] = 0
-	I[1] = 2
-	rows := len(I)
-	recMatrix := make([][]*big.Int, rows)
-	for i := 0; i < rows; i++ {
-		recMatrix[i] = matrix[I[i]][:rows]
-	}
-	invRecMatrix, _ := LSSS.GaussJordanInverse(recMatrix)
-	S, _ := LSSS.GrpLSSSReconGT(invRecMatrix, decShare, I)
-	return S
+// SubRevoke revokes the subscription key SK. DT ciphertexts created afterwards
+// cannot be decrypted with it by SubDecrypt.
+func SubRevoke(SPK *Sub.SPK, SK *Sub.SubKey) error {
+	return Sub.Revoke(SPK, SK.ID)
+}
+
+// SubDecrypt decrypts CT with the buyer's attribute key and subscription key.
+func SubDecrypt(MPK *CPABE.MPK, SPK *Sub.SPK, CT *DTCiphertext, SK *Sub.SubKey, sku *big.Int, AK *CPABE.SK) (*bn256.GT, error) {
+	return Decrypt(MPK, SPK, CT, &DecKeys{AK: AK, SubKey: SK, SKU: sku})
 }
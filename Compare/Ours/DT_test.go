@@ -3,6 +3,7 @@ package DT
 import (
 	"crypto/rand"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	//"pvgss/crypto/dleq"
@@ -10,10 +11,12 @@ import (
 	"testing"
 
 	"github.com/WXY1313/Trade/Crypto/CPABE"
+	"github.com/WXY1313/Trade/Crypto/LSSS"
 	"github.com/WXY1313/Trade/Crypto/Operation"
+	Sub "github.com/WXY1313/Trade/Crypto/Subscribe"
 	"github.com/WXY1313/Trade/Crypto/SymEnc"
 	"github.com/fentec-project/bn256"
-	// "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func min(a, b int) int {
@@ -43,53 +46,437 @@ func TestDT(t *testing.T) {
 	for i := 1; i <= 5; i++ {
 		buyerAttrs = append(buyerAttrs, "Attr"+strconv.Itoa(i)) // A1, A2, ..., A100
 	}
-	AK := AKGen(MPK, MSK, buyerAttrs)
+	AK, err := AKGen(MPK, MSK, buyerAttrs)
+	require.NoError(t, err)
 
 	//Encrypt Phase
 	Message := "Secret"
 	s, _ := rand.Int(rand.Reader, bn256.Order)
 	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
-	// Hide the trading message Message as the ciphertext ct using a symmetric key SymKey
-	ct := SymEnc.XOREncryptDecrypt([]byte(Message), SymEnc.KDF(SymKey))
 	//Construct the buying policy
 	policy := CPABE.GeneratePolicy(5)
 
-
 	//Generate and Check Ciphertext
-	CT, matrix := Encrypt(MPK, SPK, policy, s, pko)
-	cipherVer := EncVer(MPK, SPK, CT, matrix, pko)
+	CT, err := Encrypt(MPK, SPK, DefaultTrade(), policy, 0, s, map[string]*bn256.G1{LabelPer: pko})
+	require.NoError(t, err)
+	// Hide the trading message Message as the ciphertext ct using a symmetric key SymKey,
+	// binding the commitment Com as associated data
+	ct, err := SymEnc.Seal(SymKey, SymEnc.AES256GCM, []byte(Message), CT.AD())
+	require.NoError(t, err)
+	cipherVer := EncVer(MPK, SPK, CT, map[string]*bn256.G1{LabelPer: pko})
 	fmt.Printf("Ciphertext is %v\n", cipherVer)
 
 	//Pay-per Phase
 	//Seller computes re-encrypted key RK
-	RK := ReKeyGen(MPK, CT, sko, pko, pku)
+	RK, err := ReKeyGen(MPK, CT, LabelPer, sko, pko, pku)
+	require.NoError(t, err)
 	//Check the validation of RK
-	RKValid := ReKeyVer(MPK, CT, RK, vko, vku)
+	RKValid := ReKeyVer(MPK, CT, LabelPer, RK, vko, vku)
 	fmt.Printf("The rekey is %v\n", RKValid)
 	//Decrypt CT using pay-per buyer's RK and attribute key AK
-	recoverSymKey := PerDecrypt(MPK, CT, matrix, RK, sku, AK)
+	recoverSymKey, err := PerDecrypt(MPK, CT, map[string]*ReKey{LabelPer: RK}, sku, AK)
+	require.NoError(t, err)
 	if !Operation.GTEqual(SymKey, recoverSymKey) {
 		t.Fatalf("decryption failed: SymKey mismatch\noriginal: %v\nrecovered: %v",
 			SymKey, recoverSymKey)
 	} else {
-		Mes := SymEnc.XOREncryptDecrypt(ct, SymEnc.KDF(recoverSymKey))
+		Mes, err := SymEnc.Open(recoverSymKey, ct, CT.AD())
+		require.NoError(t, err)
 		fmt.Printf("Message=%v\n", string(Mes))
 	}
 
 	//Subscribe Phase
 	//Seller computes subscription key RK
-	SK := SubKeyGen(SPK, SSK, pku)
+	SK, err := SubKeyGen(SPK, SSK, pku, 0, 11)
+	require.NoError(t, err)
 	//Check the validation of RK
 	SKValid := SubKeyVer(SPK, SK, vku)
 	fmt.Printf("The subscription key is %v\n", SKValid)
 	//Decrypt CT using subscription buyer's RK and attribute key AK
-	recoverSymKey = SubDecrypt(MPK, SPK, CT, matrix, SK, sku, AK)
+	recoverSymKey, err = SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+	require.NoError(t, err)
 	if !Operation.GTEqual(SymKey, recoverSymKey) {
 		t.Fatalf("decryption failed: SymKey mismatch\noriginal: %v\nrecovered: %v",
 			SymKey, recoverSymKey)
 	} else {
-		Mes := SymEnc.XOREncryptDecrypt(ct, SymEnc.KDF(recoverSymKey))
+		Mes, err := SymEnc.Open(recoverSymKey, ct, CT.AD())
+		require.NoError(t, err)
 		fmt.Printf("Message=%v\n", string(Mes))
 	}
 
 }
+
+func TestSerialize(t *testing.T) {
+	MPK, MSK, SPK, _ := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pko := new(bn256.G1).ScalarMult(MPK.H1, sko)
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, err := Encrypt(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), 0, s, map[string]*bn256.G1{LabelPer: pko})
+	require.NoError(t, err)
+	RK, err := ReKeyGen(MPK, CT, LabelPer, sko, pko, pku)
+	require.NoError(t, err)
+
+	enc, err := CT.Marshal()
+	require.NoError(t, err)
+	CT2 := new(DTCiphertext)
+	require.NoError(t, CT2.Unmarshal(enc))
+	require.True(t, EncVer(MPK, SPK, CT2, map[string]*bn256.G1{LabelPer: pko}))
+	enc, err = RK.Marshal()
+	require.NoError(t, err)
+	RK2 := new(ReKey)
+	require.NoError(t, RK2.Unmarshal(enc))
+	recoverSymKey, err := PerDecrypt(MPK, CT2, map[string]*ReKey{LabelPer: RK2}, sku, AK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+
+	require.Error(t, new(DTCiphertext).Unmarshal(enc))
+}
+
+func TestTradeTree(t *testing.T) {
+	MPK, MSK, SPK, _ := Setup()
+	//Key leaves: the seller, an escrow agent and three co-sellers
+	keyLabels := []string{LabelPer, "escrow", "coseller1", "coseller2", "coseller3"}
+	sks := make(map[string]*big.Int)
+	pks := make(map[string]*bn256.G1)
+	for _, label := range keyLabels {
+		sks[label], _ = rand.Int(rand.Reader, bn256.Order)
+		pks[label] = new(bn256.G1).ScalarMult(MPK.H1, sks[label])
+	}
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+
+	//2-of-(P_buyer,1-of-(P_per,P_escrow,2-of-(P_coseller1,P_coseller2,P_coseller3)))
+	root := LSSS.NewNode(false, 2, 2, big.NewInt(0))
+	P_pay := LSSS.NewNode(false, 3, 1, big.NewInt(2))
+	P_co := LSSS.NewNode(false, 3, 2, big.NewInt(3))
+	root.Children = []*LSSS.Node{LSSS.NewLeaf(LabelBuyer, big.NewInt(1)), P_pay}
+	P_pay.Children = []*LSSS.Node{LSSS.NewLeaf(LabelPer, big.NewInt(1)), LSSS.NewLeaf("escrow", big.NewInt(2)), P_co}
+	P_co.Children = []*LSSS.Node{LSSS.NewLeaf("coseller1", big.NewInt(1)), LSSS.NewLeaf("coseller2", big.NewInt(2)), LSSS.NewLeaf("coseller3", big.NewInt(3))}
+
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, err := Encrypt(MPK, SPK, root, CPABE.GeneratePolicy(3), 0, s, pks)
+	require.NoError(t, err)
+	require.Nil(t, CT.C3)
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+
+	rekeys := func(labels ...string) map[string]*ReKey {
+		out := make(map[string]*ReKey)
+		for _, label := range labels {
+			out[label], err = ReKeyGen(MPK, CT, label, sks[label], pks[label], pku)
+			require.NoError(t, err)
+		}
+		return out
+	}
+	for _, labels := range [][]string{{"escrow"}, {"coseller1", "coseller3"}, {"coseller2", "coseller3"}} {
+		recoverSymKey, err := PerDecrypt(MPK, CT, rekeys(labels...), sku, AK)
+		require.NoError(t, err)
+		require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+	}
+	//One co-seller alone, or payment without the buyer's attributes, is not enough
+	_, err = PerDecrypt(MPK, CT, rekeys("coseller2"), sku, AK)
+	require.Error(t, err)
+	_, err = PerDecrypt(MPK, CT, rekeys("escrow"), sku, nil)
+	require.Error(t, err)
+
+	//1-of-(P_buyer,P_per): the re-encryption key takes fewer pairings than the
+	//attribute key, which is not used even though it would decrypt wrongly
+	either := LSSS.NewNode(false, 2, 1, big.NewInt(0))
+	either.Children = []*LSSS.Node{LSSS.NewLeaf(LabelBuyer, big.NewInt(1)), LSSS.NewLeaf(LabelPer, big.NewInt(2))}
+	CTEither, err := Encrypt(MPK, SPK, either, CPABE.GeneratePolicy(3), 0, s, pks)
+	require.NoError(t, err)
+	badAK := *AK
+	badAK.K = new(bn256.G1).Add(AK.K, MPK.G1)
+	perKey, err := ReKeyGen(MPK, CTEither, LabelPer, sks[LabelPer], pks[LabelPer], pku)
+	require.NoError(t, err)
+	recoverSymKey, err := PerDecrypt(MPK, CTEither, map[string]*ReKey{LabelPer: perKey}, sku, &badAK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+
+	//Missing key leaves are rejected at encryption, tampered shares at verification
+	_, err = Encrypt(MPK, SPK, root, CPABE.GeneratePolicy(3), 0, s, map[string]*bn256.G1{LabelPer: pks[LabelPer]})
+	require.Error(t, err)
+	CT.C2Com["coseller2"] = CT.C2Com["coseller1"]
+	require.False(t, EncVer(MPK, SPK, CT, pks))
+}
+
+func TestSharesProof(t *testing.T) {
+	MPK, _, SPK, _ := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pko := new(bn256.G1).ScalarMult(MPK.H1, sko)
+	pks := map[string]*bn256.G1{LabelPer: pko}
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	encrypt := func() *DTCiphertext {
+		CT, err := Encrypt(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), 0, s, pks)
+		require.NoError(t, err)
+		return CT
+	}
+	CT := encrypt()
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+
+	//The proof is bound to the seller's key
+	other := new(bn256.G1).ScalarMult(MPK.H1, big.NewInt(7))
+	require.False(t, EncVer(MPK, SPK, CT, map[string]*bn256.G1{LabelPer: other}))
+
+	//A well-formed subscription ciphertext for another share is caught even
+	//though it passes Sub.CipherCheck
+	x, _ := rand.Int(rand.Reader, bn256.Order)
+	SubCT, err := Sub.Encrypt(SPK, x, 0)
+	require.NoError(t, err)
+	CT.C3 = SubCT
+	require.False(t, EncVer(MPK, SPK, CT, pks))
+
+	//C2 that does not match C2Com is caught
+	CT = encrypt()
+	CT.C2[LabelPer] = new(bn256.G1).ScalarMult(pko, x)
+	require.False(t, EncVer(MPK, SPK, CT, pks))
+
+	//So is a proof taken from another ciphertext
+	CT = encrypt()
+	CT.Proof = encrypt().Proof
+	require.False(t, EncVer(MPK, SPK, CT, pks))
+}
+
+func TestReKeyProof(t *testing.T) {
+	MPK, _, SPK, _ := Setup()
+	//Registration: each party proves possession of its key pair
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pko := new(bn256.G1).ScalarMult(MPK.H1, sko)
+	vko := new(bn256.G2).ScalarMult(MPK.H2, sko)
+	popo := ProvePossession(MPK.H1, MPK.H2, sko)
+	require.True(t, VerifyPossession(MPK.H1, MPK.H2, pko, vko, popo))
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	vku := new(bn256.G2).ScalarMult(MPK.G2, sku)
+	popu := ProvePossession(MPK.G1, MPK.G2, sku)
+	require.True(t, VerifyPossession(MPK.G1, MPK.G2, pku, vku, popu))
+	//A vk that does not match pk, or a proof for another pair, is rejected
+	require.False(t, VerifyPossession(MPK.G1, MPK.G2, pku, new(bn256.G2).ScalarMult(MPK.G2, sko), popu))
+	require.False(t, VerifyPossession(MPK.H1, MPK.H2, pko, vko, popu))
+
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	CT, err := Encrypt(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), 0, s, map[string]*bn256.G1{LabelPer: pko})
+	require.NoError(t, err)
+	RK, err := ReKeyGen(MPK, CT, LabelPer, sko, pko, pku)
+	require.NoError(t, err)
+	require.True(t, ReKeyCheck(MPK, CT, LabelPer, RK, pko, pku))
+	require.True(t, ReKeyVer(MPK, CT, LabelPer, RK, vko, vku))
+
+	//A rekey for another buyer, or with a wrong D3, fails the check
+	pkw := new(bn256.G1).ScalarMult(MPK.G1, big.NewInt(5))
+	require.False(t, ReKeyCheck(MPK, CT, LabelPer, RK, pko, pkw))
+	bad := *RK
+	bad.D3 = new(bn256.G1).Add(RK.D3, MPK.G1)
+	require.False(t, ReKeyCheck(MPK, CT, LabelPer, &bad, pko, pku))
+	//A seller key not matching the ciphertext cannot produce a valid proof
+	skw, _ := rand.Int(rand.Reader, bn256.Order)
+	RKw, err := ReKeyGen(MPK, CT, LabelPer, skw, pko, pku)
+	require.NoError(t, err)
+	require.False(t, ReKeyCheck(MPK, CT, LabelPer, RKw, pko, pku))
+}
+
+func TestSubEpochs(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	//A monthly subscription for epoch 7
+	SK, err := SubKeyGen(SPK, SSK, pku, 7, 7)
+	require.NoError(t, err)
+
+	for _, epoch := range []uint64{6, 7, 8} {
+		s, _ := rand.Int(rand.Reader, bn256.Order)
+		SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+		CT, err := Encrypt(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), epoch, s, pks)
+		require.NoError(t, err)
+		require.True(t, EncVer(MPK, SPK, CT, pks))
+		recoverSymKey, err := SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+		if epoch == 7 {
+			require.NoError(t, err)
+			require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
+
+func TestSubRevoke(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	skus := make([]*big.Int, 2)
+	SKs := make([]*Sub.SubKey, 2)
+	for i := range SKs {
+		skus[i], _ = rand.Int(rand.Reader, bn256.Order)
+		var err error
+		SKs[i], err = SubKeyGen(SPK, SSK, new(bn256.G1).ScalarMult(MPK.G1, skus[i]), 0, 11)
+		require.NoError(t, err)
+	}
+	//The first buyer asks for a refund
+	require.NoError(t, SubRevoke(SPK, SKs[0]))
+
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, err := Encrypt(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), 3, s, pks)
+	require.NoError(t, err)
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+	_, err = SubDecrypt(MPK, SPK, CT, SKs[0], skus[0], AK)
+	require.Error(t, err)
+	recoverSymKey, err := SubDecrypt(MPK, SPK, CT, SKs[1], skus[1], AK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+}
+
+func TestOnlineOffline(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	SK, err := SubKeyGen(SPK, SSK, pku, 0, 11)
+	require.NoError(t, err)
+
+	pool := &Pool{MPK: MPK, SPK: SPK, Trade: DefaultTrade(), Epoch: 4, PKs: pks,
+		Cols: 3, Attrs: []string{"Attr1", "Attr2", "Attr3"}}
+	require.NoError(t, pool.Fill(2))
+	for _, policy := range []string{CPABE.GeneratePolicy(3), "Attr1 OR Attr3"} {
+		CT, s, err := pool.Encrypt(policy)
+		require.NoError(t, err)
+		require.Equal(t, policy, CT.Policy)
+		require.True(t, EncVer(MPK, SPK, CT, pks))
+		SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+		recoverSymKey, err := SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+		require.NoError(t, err)
+		require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+	}
+	require.Equal(t, 0, pool.Len())
+	_, _, err = pool.Encrypt("Attr1")
+	require.Error(t, err)
+
+	//An offline ciphertext is bound to one policy only
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	off, err := OfflineEncrypt(MPK, SPK, DefaultTrade(), 4, s, pks, 3, []string{"Attr1", "Attr2"})
+	require.NoError(t, err)
+	_, err = OnlineEncrypt(MPK, off, "Attr1 AND Attr4")
+	require.Error(t, err)
+	_, err = OnlineEncrypt(MPK, off, "Attr1 AND Attr2")
+	require.NoError(t, err)
+	_, err = OnlineEncrypt(MPK, off, "Attr1 OR Attr2")
+	require.Error(t, err)
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	SK, err := SubKeyGen(SPK, SSK, pku, 0, 11)
+	require.NoError(t, err)
+	AK, err := AKGen(MPK, MSK, []string{"Attr4"})
+	require.NoError(t, err)
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, state, err := EncryptUpdatable(MPK, SPK, DefaultTrade(), "Attr1 AND Attr2", 0, s, pks)
+	require.NoError(t, err)
+	ct, err := SymEnc.Seal(SymKey, SymEnc.AES256GCM, []byte("Secret"), CT.AD())
+	require.NoError(t, err)
+	_, err = SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+	require.Error(t, err)
+
+	//The seller admits holders of Attr4 without re-encrypting
+	uk, _, err := UpdatePolicyKeyGen(MPK, CT, state, "(Attr1 AND Attr2) OR Attr4")
+	require.NoError(t, err)
+	require.NoError(t, UpdatePolicy(CT, uk))
+	require.Equal(t, "(Attr1 AND Attr2) OR Attr4", CT.Policy)
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+	recoverSymKey, err := SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+	//The payload sealed before the update still opens
+	Mes, err := SymEnc.Open(recoverSymKey, ct, CT.AD())
+	require.NoError(t, err)
+	require.Equal(t, "Secret", string(Mes))
+}
+
+func TestHiddenPolicy(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	pku := new(bn256.G1).ScalarMult(MPK.G1, sku)
+	SK, err := SubKeyGen(SPK, SSK, pku, 0, 11)
+	require.NoError(t, err)
+	AK, err := CPABE.HiddenKeyGen(MPK, MSK, []string{"org:acme"})
+	require.NoError(t, err)
+	AK2, err := CPABE.HiddenKeyGen(MPK, MSK, []string{"org:globex"})
+	require.NoError(t, err)
+
+	label, err := CPABE.HiddenLabel(MSK, "org:acme")
+	require.NoError(t, err)
+	policy, err := CPABE.HidePolicy("org:acme", map[string]string{"org:acme": label})
+	require.NoError(t, err)
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, err := Encrypt(MPK, SPK, DefaultTrade(), policy, 0, s, pks)
+	require.NoError(t, err)
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+	require.NotContains(t, CT.Policy, "acme")
+
+	require.False(t, BuyerMatch(CT, AK2))
+	require.True(t, BuyerMatch(CT, AK))
+	recoverSymKey, err := SubDecrypt(MPK, SPK, CT, SK, sku, AK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+}
+
+func TestCCA(t *testing.T) {
+	MPK, MSK, SPK, SSK := Setup()
+	sko, _ := rand.Int(rand.Reader, bn256.Order)
+	pks := map[string]*bn256.G1{LabelPer: new(bn256.G1).ScalarMult(MPK.H1, sko)}
+	AK, err := AKGen(MPK, MSK, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	sku, _ := rand.Int(rand.Reader, bn256.Order)
+	SK, err := SubKeyGen(SPK, SSK, new(bn256.G1).ScalarMult(MPK.G1, sku), 0, 11)
+	require.NoError(t, err)
+
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	SymKey := new(bn256.GT).ScalarMult(bn256.Pair(MPK.H1, MPK.U2), s)
+	CT, err := EncryptCCA(MPK, SPK, DefaultTrade(), CPABE.GeneratePolicy(3), 3, s, pks)
+	require.NoError(t, err)
+	require.True(t, EncVer(MPK, SPK, CT, pks))
+	data, err := CT.Marshal()
+	require.NoError(t, err)
+	stored := new(DTCiphertext)
+	require.NoError(t, stored.Unmarshal(data))
+	require.True(t, stored.CCA)
+	recoverSymKey, err := SubDecrypt(MPK, SPK, stored, SK, sku, AK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(SymKey, recoverSymKey))
+
+	//A mauled sub ciphertext is an error rather than a wrong key
+	mauled := *stored
+	C3 := *stored.C3
+	C3.C1 = new(bn256.G1).Add(C3.C1, MPK.H1)
+	mauled.C3 = &C3
+	_, err = SubDecrypt(MPK, SPK, &mauled, SK, sku, AK)
+	require.Error(t, err)
+	//The mode is covered by the shares proof
+	mauled = *stored
+	mauled.CCA = false
+	require.False(t, EncVer(MPK, SPK, &mauled, pks))
+}
@@ -0,0 +1,244 @@
+package DT
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/CPABE"
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+)
+
+// SharesProof is a Fiat–Shamir proof of knowledge of the sharing vector v
+// (v[0] = s) behind a DTCiphertext: Com = g1^s, every row commitment is
+// g1^{Mi·v} and every key leaf has C2[x] = pk_x^{Mx·v} for the trade matrix M.
+// It is stored as the challenge C and the responses Z = ρ - C·v.
+type SharesProof struct {
+	C *big.Int
+	Z []*big.Int
+}
+
+// transcript hashes the public values of a proof into a challenge.
+type transcript struct {
+	h hash.Hash
+}
+
+func newTranscript(tag string) *transcript {
+	t := &transcript{h: sha512.New()}
+	t.bytes([]byte(tag))
+	return t
+}
+
+func (t *transcript) bytes(b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	t.h.Write(n[:])
+	t.h.Write(b)
+}
+
+func (t *transcript) int(x *big.Int) {
+	t.bytes([]byte{byte(x.Sign() + 1)})
+	t.bytes(x.Bytes())
+}
+
+func (t *transcript) g1(p *bn256.G1) {
+	t.bytes(p.Marshal())
+}
+
+func (t *transcript) challenge() *big.Int {
+	return new(big.Int).Mod(new(big.Int).SetBytes(t.h.Sum(nil)), bn256.Order)
+}
+
+func rowDot(row, v []*big.Int) *big.Int {
+	sum := big.NewInt(0)
+	for j, x := range row {
+		sum.Add(sum, new(big.Int).Mul(x, v[j]))
+	}
+	return sum.Mod(sum, bn256.Order)
+}
+
+// sharesStatement feeds the statement of a SharesProof into a transcript. The
+// CP-ABE policy is not part of it so the buying policy can change without
+// touching the proof.
+func sharesStatement(MPK *CPABE.MPK, CT *DTCiphertext, matrix [][]*big.Int, coms []*bn256.G1, pks map[string]*bn256.G1) *transcript {
+	t := newTranscript("DT:shares")
+	t.g1(MPK.G1)
+	t.g1(CT.Com)
+	if CT.CCA {
+		t.bytes([]byte("cca"))
+	}
+	for i, leaf := range LSSS.Leaves(CT.Trade) {
+		t.bytes([]byte(leaf.Label))
+		for _, x := range matrix[i] {
+			t.int(x)
+		}
+		t.g1(coms[i])
+		if c2, ok := CT.C2[leaf.Label]; ok {
+			t.g1(pks[leaf.Label])
+			t.g1(c2)
+		}
+	}
+	return t
+}
+
+// proveShares proves that CT was shared with the vector v.
+func proveShares(MPK *CPABE.MPK, CT *DTCiphertext, matrix [][]*big.Int, v []*big.Int, pks map[string]*bn256.G1) *SharesProof {
+	coms := shareComs(CT)
+	rho := make([]*big.Int, len(v))
+	for j := range rho {
+		rho[j], _ = rand.Int(rand.Reader, bn256.Order)
+	}
+	t := sharesStatement(MPK, CT, matrix, coms, pks)
+	t.g1(new(bn256.G1).ScalarMult(MPK.G1, rho[0]))
+	for i, leaf := range LSSS.Leaves(CT.Trade) {
+		r := rowDot(matrix[i], rho)
+		t.g1(new(bn256.G1).ScalarMult(MPK.G1, r))
+		if _, ok := CT.C2[leaf.Label]; ok {
+			t.g1(new(bn256.G1).ScalarMult(pks[leaf.Label], r))
+		}
+	}
+	c := t.challenge()
+	z := make([]*big.Int, len(v))
+	for j := range z {
+		z[j] = new(big.Int).Sub(rho[j], new(big.Int).Mul(c, v[j]))
+		z[j].Mod(z[j], bn256.Order)
+	}
+	return &SharesProof{C: c, Z: z}
+}
+
+// verifyShares recomputes the prover's commitments g^z·X^c and checks that
+// they hash to the challenge.
+func verifyShares(MPK *CPABE.MPK, CT *DTCiphertext, pks map[string]*bn256.G1) bool {
+	proof := CT.Proof
+	coms := shareComs(CT)
+	if proof == nil || proof.C == nil || coms == nil {
+		return false
+	}
+	matrix := LSSS.Convert(CT.Trade)
+	if len(proof.Z) != len(matrix[0]) {
+		return false
+	}
+	for _, z := range proof.Z {
+		if z == nil {
+			return false
+		}
+	}
+	for label := range CT.C2 {
+		if pks[label] == nil {
+			return false
+		}
+	}
+	announce := func(base *bn256.G1, z *big.Int, X *bn256.G1) *bn256.G1 {
+		return new(bn256.G1).Add(new(bn256.G1).ScalarMult(base, z), new(bn256.G1).ScalarMult(X, proof.C))
+	}
+	t := sharesStatement(MPK, CT, matrix, coms, pks)
+	t.g1(announce(MPK.G1, proof.Z[0], CT.Com))
+	for i, leaf := range LSSS.Leaves(CT.Trade) {
+		z := rowDot(matrix[i], proof.Z)
+		t.g1(announce(MPK.G1, z, coms[i]))
+		if c2, ok := CT.C2[leaf.Label]; ok {
+			t.g1(announce(pks[leaf.Label], z, c2))
+		}
+	}
+	return Operation.BigIntEqual(t.challenge(), proof.C)
+}
+
+// ReKeyProof proves that a ReKey was built as D1 = g1^r, D2 = pko^r and
+// D3 = C2^x·pku^r with pko^x = h1, i.e. x = 1/sko. It only needs G1
+// arithmetic to check.
+type ReKeyProof struct {
+	C  *big.Int
+	Zr *big.Int
+	Zx *big.Int
+}
+
+func rekeyStatement(MPK *CPABE.MPK, label string, c2, pko, pku *bn256.G1, rekey *ReKey) *transcript {
+	t := newTranscript("DT:rekey")
+	t.bytes([]byte(label))
+	t.g1(MPK.G1)
+	t.g1(MPK.H1)
+	t.g1(c2)
+	t.g1(pko)
+	t.g1(pku)
+	t.g1(rekey.D1)
+	t.g1(rekey.D2)
+	t.g1(rekey.D3)
+	return t
+}
+
+func proveReKey(MPK *CPABE.MPK, label string, c2, pko, pku *bn256.G1, rekey *ReKey, r, x *big.Int) *ReKeyProof {
+	rhoR, _ := rand.Int(rand.Reader, bn256.Order)
+	rhoX, _ := rand.Int(rand.Reader, bn256.Order)
+	t := rekeyStatement(MPK, label, c2, pko, pku, rekey)
+	t.g1(new(bn256.G1).ScalarMult(MPK.G1, rhoR))
+	t.g1(new(bn256.G1).ScalarMult(pko, rhoR))
+	t.g1(new(bn256.G1).Add(new(bn256.G1).ScalarMult(c2, rhoX), new(bn256.G1).ScalarMult(pku, rhoR)))
+	t.g1(new(bn256.G1).ScalarMult(pko, rhoX))
+	c := t.challenge()
+	zr := new(big.Int).Sub(rhoR, new(big.Int).Mul(c, r))
+	zx := new(big.Int).Sub(rhoX, new(big.Int).Mul(c, x))
+	return &ReKeyProof{C: c, Zr: zr.Mod(zr, bn256.Order), Zx: zx.Mod(zx, bn256.Order)}
+}
+
+func verifyReKey(MPK *CPABE.MPK, label string, c2, pko, pku *bn256.G1, rekey *ReKey) bool {
+	proof := rekey.Proof
+	if proof == nil || proof.C == nil || proof.Zr == nil || proof.Zx == nil {
+		return false
+	}
+	mul := func(base *bn256.G1, z *big.Int) *bn256.G1 {
+		return new(bn256.G1).ScalarMult(base, z)
+	}
+	t := rekeyStatement(MPK, label, c2, pko, pku, rekey)
+	t.g1(new(bn256.G1).Add(mul(MPK.G1, proof.Zr), mul(rekey.D1, proof.C)))
+	t.g1(new(bn256.G1).Add(mul(pko, proof.Zr), mul(rekey.D2, proof.C)))
+	a3 := new(bn256.G1).Add(mul(c2, proof.Zx), mul(pku, proof.Zr))
+	t.g1(a3.Add(a3, mul(rekey.D3, proof.C)))
+	t.g1(new(bn256.G1).Add(mul(pko, proof.Zx), mul(MPK.H1, proof.C)))
+	return Operation.BigIntEqual(t.challenge(), proof.C)
+}
+
+// PoP is a proof of possession of sk for a registered key pair
+// (pk = base1^sk, vk = base2^sk) across G1 and G2.
+type PoP struct {
+	C *big.Int
+	Z *big.Int
+}
+
+func popStatement(base1 *bn256.G1, base2 *bn256.G2, pk *bn256.G1, vk *bn256.G2) *transcript {
+	t := newTranscript("DT:pop")
+	t.g1(base1)
+	t.bytes(base2.Marshal())
+	t.g1(pk)
+	t.bytes(vk.Marshal())
+	return t
+}
+
+// ProvePossession proves knowledge of sk for (base1^sk, base2^sk). Sellers use
+// the bases (h1,h2) and buyers (g1,g2).
+func ProvePossession(base1 *bn256.G1, base2 *bn256.G2, sk *big.Int) *PoP {
+	pk := new(bn256.G1).ScalarMult(base1, sk)
+	vk := new(bn256.G2).ScalarMult(base2, sk)
+	rho, _ := rand.Int(rand.Reader, bn256.Order)
+	t := popStatement(base1, base2, pk, vk)
+	t.g1(new(bn256.G1).ScalarMult(base1, rho))
+	t.bytes(new(bn256.G2).ScalarMult(base2, rho).Marshal())
+	c := t.challenge()
+	z := new(big.Int).Sub(rho, new(big.Int).Mul(c, sk))
+	return &PoP{C: c, Z: z.Mod(z, bn256.Order)}
+}
+
+// VerifyPossession checks that pk and vk share the same secret exponent with
+// respect to base1 and base2 and that the registrant knows it.
+func VerifyPossession(base1 *bn256.G1, base2 *bn256.G2, pk *bn256.G1, vk *bn256.G2, pop *PoP) bool {
+	if pop == nil || pop.C == nil || pop.Z == nil {
+		return false
+	}
+	t := popStatement(base1, base2, pk, vk)
+	t.g1(new(bn256.G1).Add(new(bn256.G1).ScalarMult(base1, pop.Z), new(bn256.G1).ScalarMult(pk, pop.C)))
+	t.bytes(new(bn256.G2).Add(new(bn256.G2).ScalarMult(base2, pop.Z), new(bn256.G2).ScalarMult(vk, pop.C)).Marshal())
+	return Operation.BigIntEqual(t.challenge(), pop.C)
+}
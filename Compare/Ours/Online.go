@@ -0,0 +1,108 @@
+package DT
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/CPABE"
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	Sub "github.com/WXY1313/Trade/Crypto/Subscribe"
+	"github.com/fentec-project/bn256"
+)
+
+// OfflineCT is a DT ciphertext computed before its buying policy is known.
+// Only the buyer leaf depends on the policy, and the shares proof does not,
+// so everything except the CP-ABE rows of C1 is done offline.
+type OfflineCT struct {
+	ct  *DTCiphertext
+	abe *CPABE.OfflineCT // nil if the trade tree has no buyer leaf
+}
+
+// OfflineEncrypt prepares the encryption of s over the trade tree for any
+// buying policy with at most cols MSP columns over attrs.
+func OfflineEncrypt(MPK *CPABE.MPK, SPK *Sub.SPK, trade *LSSS.Node, epoch uint64, s *big.Int, pks map[string]*bn256.G1, cols int, attrs []string) (*OfflineCT, error) {
+	off := new(OfflineCT)
+	CT, err := encrypt(MPK, SPK, trade, epoch, s, pks, false, func(m *big.Int) (*CPABE.ABECiphertext, error) {
+		var err error
+		off.abe, err = CPABE.OfflineEncrypt(MPK, m, cols, attrs)
+		if err != nil {
+			return nil, err
+		}
+		//Stands in for C1 until the policy is bound
+		return &CPABE.ABECiphertext{Com: off.abe.Com()}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	off.ct = CT
+	return off, nil
+}
+
+// OnlineEncrypt binds an offline ciphertext to the buying policy. Each
+// offline ciphertext can be bound once.
+func OnlineEncrypt(MPK *CPABE.MPK, off *OfflineCT, policy string) (*DTCiphertext, error) {
+	CT := *off.ct
+	CT.Policy = policy
+	if off.abe != nil {
+		var err error
+		CT.C1, err = CPABE.OnlineEncrypt(MPK, off.abe, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &CT, nil
+}
+
+// Pool keeps offline ciphertexts of fresh random secrets for one trade tree,
+// so a seller gateway can publish listings with OnlineEncrypt only. A Pool is
+// not safe for concurrent use.
+type Pool struct {
+	MPK   *CPABE.MPK
+	SPK   *Sub.SPK
+	Trade *LSSS.Node
+	Epoch uint64
+	PKs   map[string]*bn256.G1
+	Cols  int
+	Attrs []string
+
+	items   []*OfflineCT
+	secrets []*big.Int
+}
+
+// Fill adds n offline ciphertexts to the pool.
+func (p *Pool) Fill(n int) error {
+	for i := 0; i < n; i++ {
+		s, err := rand.Int(rand.Reader, bn256.Order)
+		if err != nil {
+			return err
+		}
+		off, err := OfflineEncrypt(p.MPK, p.SPK, p.Trade, p.Epoch, s, p.PKs, p.Cols, p.Attrs)
+		if err != nil {
+			return err
+		}
+		p.items = append(p.items, off)
+		p.secrets = append(p.secrets, s)
+	}
+	return nil
+}
+
+// Len returns the number of offline ciphertexts left.
+func (p *Pool) Len() int {
+	return len(p.items)
+}
+
+// Encrypt takes an offline ciphertext from the pool and binds it to policy.
+// It returns the ciphertext and its secret s.
+func (p *Pool) Encrypt(policy string) (*DTCiphertext, *big.Int, error) {
+	if len(p.items) == 0 {
+		return nil, nil, fmt.Errorf("offline pool is empty")
+	}
+	off, s := p.items[0], p.secrets[0]
+	CT, err := OnlineEncrypt(p.MPK, off, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.items, p.secrets = p.items[1:], p.secrets[1:]
+	return CT, s, nil
+}
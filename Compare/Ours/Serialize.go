@@ -0,0 +1,127 @@
+package DT
+
+import (
+	"fmt"
+
+	"github.com/WXY1313/Trade/Crypto/CPABE"
+	"github.com/WXY1313/Trade/Crypto/Codec"
+	Sub "github.com/WXY1313/Trade/Crypto/Subscribe"
+)
+
+// Marshal encodes the trade ciphertext. The embedded ABE and subscription
+// ciphertexts are written with their own headers and are absent when the
+// trade tree has no buyer or sub leaf.
+func (CT *DTCiphertext) Marshal() ([]byte, error) {
+	var c1, c3 []byte
+	var err error
+	if CT.C1 != nil {
+		if c1, err = CT.C1.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	if CT.C3 != nil {
+		if c3, err = CT.C3.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	e := Codec.NewEncoder(Codec.TypeDTCiphertext)
+	e.String(CT.Policy)
+	e.Tree(CT.Trade)
+	e.G1(CT.Com)
+	e.Bool(CT.C1 != nil)
+	if CT.C1 != nil {
+		e.Blob(c1)
+	}
+	e.G1Map(CT.C2)
+	e.G1Map(CT.C2Com)
+	e.Bool(CT.C3 != nil)
+	if CT.C3 != nil {
+		e.Blob(c3)
+	}
+	if CT.Proof == nil {
+		return nil, fmt.Errorf("trade ciphertext without shares proof")
+	}
+	e.Scalar(CT.Proof.C)
+	e.Uint32(len(CT.Proof.Z))
+	for _, z := range CT.Proof.Z {
+		e.Scalar(z)
+	}
+	e.Bool(CT.CCA)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a trade ciphertext produced by Marshal.
+func (CT *DTCiphertext) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeDTCiphertext)
+	out := &DTCiphertext{Policy: d.String(),
+		Trade: d.Tree(),
+		Com:   d.G1()}
+	var c1, c3 []byte
+	hasC1 := d.Bool()
+	if hasC1 {
+		c1 = d.Blob()
+	}
+	out.C2 = d.G1Map()
+	out.C2Com = d.G1Map()
+	hasC3 := d.Bool()
+	if hasC3 {
+		c3 = d.Blob()
+	}
+	out.Proof = &SharesProof{C: d.Scalar()}
+	for n := d.Uint32(); n > 0 && d.Err() == nil; n-- {
+		out.Proof.Z = append(out.Proof.Z, d.Scalar())
+	}
+	out.CCA = d.Bool()
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if hasC1 {
+		out.C1 = new(CPABE.ABECiphertext)
+		if err := out.C1.Unmarshal(c1); err != nil {
+			return err
+		}
+	}
+	if hasC3 {
+		out.C3 = new(Sub.SubCiphertext)
+		if err := out.C3.Unmarshal(c3); err != nil {
+			return err
+		}
+	}
+	*CT = *out
+	return nil
+}
+
+// Marshal encodes the re-encryption key.
+func (rekey *ReKey) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeDTReKey)
+	e.G1(rekey.D1)
+	e.G1(rekey.D2)
+	e.G1(rekey.D3)
+	if rekey.Proof == nil {
+		return nil, fmt.Errorf("re-encryption key without proof")
+	}
+	e.Scalar(rekey.Proof.C)
+	e.Scalar(rekey.Proof.Zr)
+	e.Scalar(rekey.Proof.Zx)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a re-encryption key produced by Marshal.
+func (rekey *ReKey) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeDTReKey)
+	out := &ReKey{
+		D1: d.G1(),
+		D2: d.G1(),
+		D3: d.G1(),
+		Proof: &ReKeyProof{
+			C:  d.Scalar(),
+			Zr: d.Scalar(),
+			Zx: d.Scalar(),
+		},
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	*rekey = *out
+	return nil
+}
@@ -0,0 +1,108 @@
+package CPABE
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+)
+
+// CCA mode in the style of the Fujisaki-Okamoto transform. EncryptCCA draws
+// v and the ri from a random oracle on (Message, Com, MSP) instead of fresh
+// randomness. DecryptCCA decrypts as usual, recomputes the randomness from
+// the message it got and checks the ciphertext component by component, so
+// any change to C, _C, CA, the rows or the tag is an error rather than a
+// wrong message. The message has full entropy as m is uniform.
+//
+// A CCA ciphertext cannot be changed after encryption: UpdateCiphertext and
+// UpdatePolicy make it fail the check.
+
+// EncryptCCA encrypts m under policy in CCA mode.
+func EncryptCCA(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
+	msp, err := policyMSP(policy)
+	if err != nil {
+		return nil, err
+	}
+	M := bn256.Pair(new(bn256.G1).ScalarMult(MPK.H1, m), MPK.U2)
+	CT, _, err := encrypt(MPK, m, msp, foSampler(M, new(bn256.G1).ScalarBaseMult(m), msp))
+	return CT, err
+}
+
+// DecryptCCA decrypts a ciphertext of EncryptCCA and rejects it if it was
+// tampered with.
+func DecryptCCA(MPK *MPK, CT *ABECiphertext, SK *SK) (*bn256.GT, error) {
+	M, err := Decrypt(MPK, CT, SK)
+	if err != nil {
+		return nil, err
+	}
+	if !reencrypts(MPK, CT, M) {
+		return nil, fmt.Errorf("ciphertext failed the re-encryption check")
+	}
+	return M, nil
+}
+
+// reencrypts tells whether CT is the CCA encryption of M.
+func reencrypts(MPK *MPK, CT *ABECiphertext, M *bn256.GT) bool {
+	if CT.Com == nil || CT.C == nil || CT._C == nil || CT.CA == nil || CT.MSP == nil || len(CT.MSP.Mat) == 0 {
+		return false
+	}
+	if subtle.ConstantTimeCompare(MessageTag(M), CT.Tag) != 1 {
+		return false
+	}
+	sampler := foSampler(M, CT.Com, CT.MSP)
+	v, err := data.NewRandomVector(CT.MSP.Mat.Cols(), sampler)
+	if err != nil {
+		return false
+	}
+	beta := v[0]
+	betaInv := new(big.Int).ModInverse(beta, MPK.Order)
+	lambdaI, err := CT.MSP.Mat.MulVec(v)
+	if err != nil {
+		return false
+	}
+	rI, err := data.NewRandomVector(len(CT.MSP.Mat), sampler)
+	if err != nil {
+		return false
+	}
+	if !Operation.G2Equal(CT._C, new(bn256.G2).ScalarMult(MPK.G2, beta)) || !Operation.G2Equal(CT.CA, new(bn256.G2).ScalarMult(MPK.AG2, beta)) {
+		return false
+	}
+	//C/g1^{alpha*beta} = h1^m with g1^m = Com and e(h1^m,u2) = M
+	hm := new(bn256.G1).Add(CT.C, new(bn256.G1).Neg(new(bn256.G1).ScalarMult(MPK.AlphaG1, beta)))
+	if !Operation.GTEqual(bn256.Pair(hm, MPK.U2), M) || !Operation.GTEqual(bn256.Pair(hm, MPK.G2), bn256.Pair(CT.Com, MPK.H2)) {
+		return false
+	}
+	if len(CT.C1) != len(CT.MSP.Mat) || len(CT.C2) != len(CT.MSP.Mat) || len(CT.C3) != len(CT.MSP.Mat) {
+		return false
+	}
+	for i, at := range CT.MSP.RowToAttrib {
+		if CT.Versions[at] != MPK.Versions[at] {
+			return false
+		}
+		lambda := lambdaI[i].Mod(lambdaI[i], MPK.Order)
+		c1 := new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, lambda), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(AttrElement(MPK, at), rI[i])))
+		c3 := new(big.Int).Mul(lambda, betaInv)
+		if !Operation.G1Equal(CT.C1[at], c1) || !Operation.G2Equal(CT.C2[at], new(bn256.G2).ScalarMult(MPK.G2, rI[i])) ||
+			!Operation.G1Equal(CT.C3[at], new(bn256.G1).ScalarMult(MPK.H1, c3.Mod(c3, MPK.Order))) {
+			return false
+		}
+	}
+	return true
+}
+
+// foSampler is the random oracle fixing the randomness of a CCA ciphertext.
+func foSampler(M *bn256.GT, com *bn256.G1, msp *abe.MSP) *Operation.OracleSampler {
+	h := sha256.New()
+	h.Write([]byte("CPABE:fo"))
+	h.Write(M.Marshal())
+	h.Write(com.Marshal())
+	for i, at := range msp.RowToAttrib {
+		fmt.Fprintf(h, "%d:%s%v", len(at), at, msp.Mat[i])
+	}
+	return Operation.NewOracleSampler(h.Sum(nil))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/WXY1313/Trade/Crypto/Operation"
 	"github.com/fentec-project/bn256"
@@ -21,13 +22,24 @@ type MPK struct {
 	H1      *bn256.G1
 	H2      *bn256.G2
 	AlphaG1 *bn256.G1
-	HXsG1   map[string]*bn256.G1
-	HXsG2   map[string]*bn256.G2
 	Order   *big.Int
+	// Attribute versions, see Revoke.go. Attributes that were never revoked
+	// are at version 0 with element H(x) and have no entry.
+	AttrPKs  map[string]*bn256.G1
+	Versions map[string]uint64
+	KappaG2  *bn256.G2 // g2^κ, checks the hidden attribute OPRF, see Hidden.go
+	AG1      *bn256.G1 // g1^a, binds keys to their tracing tag, see Trace.go
+	AG2      *bn256.G2 // g2^a
 }
 
 type MSK struct {
-	Alpha *big.Int
+	Alpha    *big.Int
+	Versions map[string]*big.Int // version key vx of each revoked attribute
+	Kappa    *big.Int            // OPRF key of hidden attribute labels
+	A        *big.Int            // tracing key
+	// Identities maps the tracing tag T of every key issued by KeyGenID,
+	// written in decimal, to the identity it was issued to.
+	Identities map[string]string
 }
 
 type CPABE struct {
@@ -35,9 +47,12 @@ type CPABE struct {
 }
 
 type SK struct {
-	K   *bn256.G1
-	L   *bn256.G2
-	KXs map[string]*bn256.G2
+	K        *bn256.G1 // K = (u1^alpha*h1^t)^{1/(a+T)}
+	L        *bn256.G2
+	T        *big.Int  // tracing tag
+	D        *bn256.G1 // D = h1^{1/(a+T)}, rerandomizes t in Delegate
+	KXs      map[string]*bn256.G1
+	Versions map[string]uint64 // attribute version each Kx was issued or updated for
 }
 
 type ABECiphertext struct {
@@ -46,9 +61,24 @@ type ABECiphertext struct {
 	MSP     *abe.MSP             // (M, ρ)
 	C       *bn256.G1            //C=h1^m*g1^{alpha*beta}
 	_C      *bn256.G2            //_C=h2^{beta}
-	C1      map[string]*bn256.G1 //Ci  = w1^{λi}hiG1^{-ri}
-	C2      map[string]*bn256.G1 //Ci' = g1^{ri}
-	C3      map[string]*bn256.G1 //Ci''=g^{λi}
+	CA      *bn256.G2            //CA=g2^{a*beta}
+	C1      map[string]*bn256.G1 //Ci  = h1^{λi}PK_ρ(i)^{-ri}
+	C2      map[string]*bn256.G2 //Ci' = g2^{ri}
+	C3      map[string]*bn256.G1 //Ci''=h1^{λi/beta}
+	// Versions holds the attribute version each row was encrypted or updated for
+	Versions map[string]uint64
+	Tag      []byte // Tag = SHA256(Message), checked by Retrieve
+}
+
+// HashAttr maps an arbitrary attribute name to its group element H(x) in G1.
+// Attribute elements are derived on demand, so the attribute universe is
+// unbounded and the MPK does not grow with it.
+func HashAttr(at string) *bn256.G1 {
+	hx, err := bn256.HashG1("CPABE:attr:" + at)
+	if err != nil {
+		panic(err)
+	}
+	return hx
 }
 
 func LSSSRecon(msp *abe.MSP, idToShare map[string]*bn256.G1) (*bn256.G1, error) {
@@ -91,11 +121,6 @@ func NewCPABE() *CPABE {
 }
 
 func Setup() (*MPK, *MSK, error) {
-	//Generate sytem attribute set
-	var attributeUniverse []string
-	for i := 1; i <= 100; i++ {
-		attributeUniverse = append(attributeUniverse, "Attr"+strconv.Itoa(i)) // Attr1, Attr2, ..., Attr100
-	}
 	sampler := sample.NewUniformRange(big.NewInt(1), NewCPABE().P)
 	alpha, _ := sampler.Sample()
 	//The group elements
@@ -108,53 +133,132 @@ func Setup() (*MPK, *MSK, error) {
 	u_exponent, _ := sampler.Sample()
 	uG1 := new(bn256.G1).ScalarBaseMult(u_exponent)
 	uG2 := new(bn256.G2).ScalarBaseMult(u_exponent)
-	//For each x in U: h1x=h1^{rx}, h2x=h2^{rx}
-	hxsG1 := make(map[string]*bn256.G1)
-	hxsG2 := make(map[string]*bn256.G2)
-	for i := 0; i < len(attributeUniverse); i++ {
-		//hx := HashToG1(attributeUniverse[i])
-		r_i, _ := sampler.Sample()
-		hxG1 := new(bn256.G1).ScalarMult(hG1, r_i)
-		hxG2 := new(bn256.G2).ScalarMult(hG2, r_i)
-		hxsG1[attributeUniverse[i]] = hxG1
-		hxsG2[attributeUniverse[i]] = hxG2
-	}
+	//Attribute elements H(x) are hashed on demand, see HashAttr
+	kappa, _ := sampler.Sample()
+	a, _ := sampler.Sample()
 
 	ABEMPK := &MPK{
-		G1:      gG1,
-		G2:      gG2,
-		U1:      uG1,
-		U2:      uG2,
-		H1:      hG1,
-		H2:      hG2,
-		AlphaG1: alphaG1,
-		HXsG1:   hxsG1,
-		HXsG2:   hxsG2,
-		Order:   bn256.Order,
+		G1:       gG1,
+		G2:       gG2,
+		U1:       uG1,
+		U2:       uG2,
+		H1:       hG1,
+		H2:       hG2,
+		AlphaG1:  alphaG1,
+		Order:    bn256.Order,
+		AttrPKs:  make(map[string]*bn256.G1),
+		Versions: make(map[string]uint64),
+		KappaG2:  new(bn256.G2).ScalarBaseMult(kappa),
+		AG1:      new(bn256.G1).ScalarBaseMult(a),
+		AG2:      new(bn256.G2).ScalarBaseMult(a),
 	}
 	ABEMSK := &MSK{
-		Alpha: alpha,
+		Alpha:      alpha,
+		Versions:   make(map[string]*big.Int),
+		Kappa:      kappa,
+		A:          a,
+		Identities: make(map[string]string),
 	}
 
 	return ABEMPK, ABEMSK, nil
 }
 
 func KeyGen(MPK *MPK, MSK *MSK, su []string) (*SK, error) {
+	//T←Zp with a+T≠0
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	T, _ := sampler.Sample()
+	for new(big.Int).Add(MSK.A, T).Cmp(MPK.Order) == 0 {
+		T, _ = sampler.Sample()
+	}
+	return keyGen(MPK, MSK, T, su)
+}
+
+// keyGen issues a key with tracing tag T.
+func keyGen(MPK *MPK, MSK *MSK, T *big.Int, su []string) (*SK, error) {
 	//t←Zp,L=g^t
 	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
 	t, _ := sampler.Sample()
+	//K=(u1^alpha*h1^t)^{1/(a+T)}
+	aT := new(big.Int).Add(MSK.A, T)
+	if aT.Mod(aT, MPK.Order).Sign() == 0 {
+		return nil, fmt.Errorf("invalid tracing tag")
+	}
+	aTInv := new(big.Int).ModInverse(aT, MPK.Order)
 	k := new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.U1, MSK.Alpha), new(bn256.G1).ScalarMult(MPK.H1, t))
+	k.ScalarMult(k, aTInv)
 	l := new(bn256.G2).ScalarMult(MPK.G2, t) //L=g^t
-	//{Kx = hxG2^t}x∈Su
-	kxs := make(map[string]*bn256.G2)
+	//{Kx = PK_x^t}x∈Su
+	kxs := make(map[string]*bn256.G1)
+	versions := make(map[string]uint64)
 	for i := 0; i < len(su); i++ {
-		_, ok := MPK.HXsG2[su[i]]
-		if !ok {
-			return nil, fmt.Errorf("attribute %s not in public parameters", su[i])
+		if su[i] == "" {
+			return nil, fmt.Errorf("empty attribute name")
+		}
+		kxs[su[i]] = new(bn256.G1).ScalarMult(AttrElement(MPK, su[i]), t)
+		versions[su[i]] = MPK.Versions[su[i]]
+	}
+	d := new(bn256.G1).ScalarMult(MPK.H1, aTInv)
+	return &SK{K: k, L: l, T: T, D: d, KXs: kxs, Versions: versions}, nil
+}
+
+// KeyCheck lets a buyer verify SK under MPK before using it, see wellFormed.
+// Every attribute must be at its current version.
+func KeyCheck(mpk *MPK, sk *SK) bool {
+	for at := range sk.KXs {
+		if sk.Versions[at] != mpk.Versions[at] {
+			return false
 		}
-		kxs[su[i]] = new(bn256.G2).ScalarMult(MPK.HXsG2[su[i]], t)
 	}
-	return &SK{K: k, L: l, KXs: kxs}, nil
+	return wellFormed(mpk, mpk.AlphaG1, sk)
+}
+
+// wellFormed tells whether SK is a well formed key for alphaG1 = g1^alpha,
+// i.e. e(K,g2^a*g2^T) = e(g1^alpha,u2)e(h1,L), e(D,g2^a*g2^T) = e(h1,g2) and
+// e(Kx,g2) = e(PK_x,L) for every attribute at its current version. The
+// equations are batched with random r and rx into
+//
+//	e(K·D^r,g2^a*g2^T)e(h1^{-r}∏Kx^{rx},g2) = e(g1^alpha,u2)e(h1∏PK_x^{rx},L)
+//
+// which costs four pairings for any number of attributes.
+func wellFormed(MPK *MPK, alphaG1 *bn256.G1, SK *SK) bool {
+	return keyEquations(MPK, alphaG1, SK, true)
+}
+
+// traceable is wellFormed without the equation of D. D only serves Delegate,
+// so a key without it still decrypts and must still be traced.
+func traceable(MPK *MPK, alphaG1 *bn256.G1, SK *SK) bool {
+	return keyEquations(MPK, alphaG1, SK, false)
+}
+
+// keyEquations checks the batched key equations, those of D only if withD.
+func keyEquations(MPK *MPK, alphaG1 *bn256.G1, SK *SK, withD bool) bool {
+	if SK.K == nil || SK.L == nil || SK.T == nil || (withD && SK.D == nil) {
+		return false
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	kd := new(bn256.G1).Set(SK.K)
+	kxs := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	if withD {
+		r, _ := sampler.Sample()
+		kd.Add(kd, new(bn256.G1).ScalarMult(SK.D, r))
+		kxs.Neg(new(bn256.G1).ScalarMult(MPK.H1, r))
+	}
+	pks := new(bn256.G1).Set(MPK.H1)
+	for at, kx := range SK.KXs {
+		if kx == nil {
+			return false
+		}
+		if SK.Versions[at] != MPK.Versions[at] {
+			continue
+		}
+		rx, _ := sampler.Sample()
+		kxs.Add(kxs, new(bn256.G1).ScalarMult(kx, rx))
+		pks.Add(pks, new(bn256.G1).ScalarMult(AttrElement(MPK, at), rx))
+	}
+	aT := new(bn256.G2).Add(MPK.AG2, new(bn256.G2).ScalarMult(MPK.G2, SK.T))
+	left := new(bn256.GT).Add(bn256.Pair(kd, aT), bn256.Pair(kxs, MPK.G2))
+	right := new(bn256.GT).Add(bn256.Pair(alphaG1, MPK.U2), bn256.Pair(pks, SK.L))
+	return Operation.GTEqual(left, right)
 }
 
 // Generate an access structure
@@ -192,11 +296,12 @@ func GeneratePolicy(attrCount int) string {
 	return policy
 }
 
-func Encrypt(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
-	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
-	msp, _ := abe.BooleanToMSP(policy, false)
-	mspRows := msp.Mat.Rows()
-	mspCols := msp.Mat.Cols()
+// policyMSP converts a boolean policy into an MSP with one row per attribute.
+func policyMSP(policy string) (*abe.MSP, error) {
+	msp, err := abe.BooleanToMSP(policy, false)
+	if err != nil {
+		return nil, err
+	}
 	// sanity checks
 	if len(msp.Mat) == 0 || len(msp.Mat[0]) == 0 {
 		return nil, fmt.Errorf("empty msp matrix")
@@ -209,13 +314,69 @@ func Encrypt(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
 		}
 		attribs[i] = true
 	}
+	return msp, nil
+}
+
+// GenerateThresholdPolicy generates a random tree of k-of-n gates over
+// attrCount attributes, written for EncryptReuse.
+func GenerateThresholdPolicy(attrCount int) string {
+	randInt := func(n int) int {
+		r, _ := rand.Int(rand.Reader, big.NewInt(int64(n)))
+		return int(r.Int64())
+	}
+	var build func(first, count int) string
+	build = func(first, count int) string {
+		if count == 1 {
+			return "Attr" + strconv.Itoa(first)
+		}
+		// Split into 2 to 4 children
+		n := min(randInt(3)+2, count)
+		parts := make([]string, n)
+		for i := 0; i < n; i++ {
+			size := count / (n - i)
+			parts[i] = build(first, size)
+			first, count = first+size, count-size
+		}
+		return strconv.Itoa(randInt(n)+1) + " of (" + strings.Join(parts, ", ") + ")"
+	}
+	return build(1, attrCount)
+}
+
+func Encrypt(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
+	msp, err := policyMSP(policy)
+	if err != nil {
+		return nil, err
+	}
+	CT, _, err := encrypt(MPK, m, msp, sample.NewUniformRange(big.NewInt(1), MPK.Order))
+	return CT, err
+}
+
+// EncryptUpdatable encrypts like Encrypt and also returns the encryptor's
+// state for UpdatePolicyKeyGen.
+func EncryptUpdatable(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, *UpdateState, error) {
+	msp, err := policyMSP(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	CT, v, err := encrypt(MPK, m, msp, sample.NewUniformRange(big.NewInt(1), MPK.Order))
+	if err != nil {
+		return nil, nil, err
+	}
+	return CT, &UpdateState{v: v}, nil
+}
+
+// encrypt encrypts m under msp, drawing v and then the ri from sampler, and
+// returns v alongside the ciphertext.
+func encrypt(MPK *MPK, m *big.Int, msp *abe.MSP, sampler sample.Sampler) (*ABECiphertext, data.Vector, error) {
+	mspRows := msp.Mat.Rows()
+	mspCols := msp.Mat.Cols()
 
 	//Generate the ABE ciphertext
 	// pick random vector v with random s as first element
 	// beta ∈ Zp
 	v, err := data.NewRandomVector(mspCols, sampler)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	beta := v[0]
 	betaInv := new(big.Int).ModInverse(beta, MPK.Order)
@@ -223,13 +384,14 @@ func Encrypt(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
 	M := bn256.Pair(new(bn256.G1).ScalarMult(MPK.H1, m), MPK.U2)
 	c := new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, m), new(bn256.G1).ScalarMult(MPK.AlphaG1, beta))
 	_c := new(bn256.G2).ScalarMult(MPK.G2, beta)
+	ca := new(bn256.G2).ScalarMult(MPK.AG2, beta)
 
 	lambdaI, err := msp.Mat.MulVec(v)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(lambdaI) != mspRows {
-		return nil, fmt.Errorf("wrong lambda len")
+		return nil, nil, fmt.Errorf("wrong lambda len")
 	}
 	lambda := make(map[string]*big.Int)
 	for i, at := range msp.RowToAttrib {
@@ -241,31 +403,36 @@ func Encrypt(MPK *MPK, m *big.Int, policy string) (*ABECiphertext, error) {
 		r[at] = rI[i].Mod(rI[i], bn256.Order)
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	C1Set := make(map[string]*bn256.G1)
-	C2Set := make(map[string]*bn256.G1)
+	C2Set := make(map[string]*bn256.G2)
 	C3Set := make(map[string]*bn256.G1)
+	versions := make(map[string]uint64)
 	//Parse the access policy
 	for _, at := range msp.RowToAttrib {
-		C1Set[at] = new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, lambda[at]), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(MPK.HXsG1[at], r[at])))
-		C2Set[at] = new(bn256.G1).ScalarMult(MPK.G1, r[at])
+		C1Set[at] = new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, lambda[at]), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(AttrElement(MPK, at), r[at])))
+		versions[at] = MPK.Versions[at]
+		C2Set[at] = new(bn256.G2).ScalarMult(MPK.G2, r[at])
 		result := new(big.Int).Mul(lambda[at], betaInv)
 		result.Mod(result, MPK.Order)
 		C3Set[at] = new(bn256.G1).ScalarMult(MPK.H1, result)
 	}
 
 	return &ABECiphertext{
-		Message: M,
-		Com:     com,   // Com = gG1^m
-		MSP:     msp,   // (M, ρ)
-		C:       c,     //C=e(hG1,uG2)^me(hG1,uG2)^{alpha*beta}
-		_C:      _c,    //_C=gG2^{beta}
-		C1:      C1Set, //Ci  = h^{a*λi}hiG1^{-ri}
-		C2:      C2Set, //Ci' = hG1^{ri}
-		C3:      C3Set, //Ci''=h^{λi}
-	}, nil
+		Message:  M,
+		Com:      com,   // Com = gG1^m
+		MSP:      msp,   // (M, ρ)
+		C:        c,     //C=e(hG1,uG2)^me(hG1,uG2)^{alpha*beta}
+		_C:       _c,    //_C=gG2^{beta}
+		CA:       ca,    //CA=(g2^a)^{beta}
+		C1:       C1Set, //Ci  = h1^{λi}H(ρ(i))^{-ri}
+		C2:       C2Set, //Ci' = g2^{ri}
+		C3:       C3Set, //Ci''=h1^{λi/beta}
+		Versions: versions,
+		Tag:      MessageTag(M),
+	}, v, nil
 
 }
 
@@ -273,8 +440,18 @@ func CipherCheck(mpk *MPK, ct *ABECiphertext) bool {
 	if !Operation.GTEqual(bn256.Pair(ct.C, mpk.G2), new(bn256.GT).Add(bn256.Pair(ct.Com, mpk.H2), bn256.Pair(mpk.AlphaG1, ct._C))) {
 		return false
 	}
+	if !Operation.GTEqual(bn256.Pair(mpk.G1, ct.CA), bn256.Pair(mpk.AG1, ct._C)) {
+		return false
+	}
 	for _, at := range ct.MSP.RowToAttrib {
-		if !Operation.GTEqual(bn256.Pair(ct.C1[at], mpk.G2), new(bn256.GT).Add(bn256.Pair(ct.C3[at], ct._C), bn256.Pair(new(bn256.G1).Neg(ct.C2[at]), mpk.HXsG2[at]))) {
+		if ct.C1[at] == nil || ct.C2[at] == nil || ct.C3[at] == nil {
+			return false
+		}
+		//Ciphertexts of an older attribute version must be updated first
+		if ct.Versions[at] != mpk.Versions[at] {
+			return false
+		}
+		if !Operation.GTEqual(bn256.Pair(ct.C1[at], mpk.G2), new(bn256.GT).Add(bn256.Pair(ct.C3[at], ct._C), bn256.Pair(new(bn256.G1).Neg(AttrElement(mpk, at)), ct.C2[at]))) {
 			return false
 		}
 	}
@@ -287,15 +464,27 @@ func CipherCheck(mpk *MPK, ct *ABECiphertext) bool {
 }
 
 func Decrypt(MPK *MPK, CT *ABECiphertext, SK *SK) (*bn256.GT, error) {
+	eggs, err := keyPart(CT, SK)
+	if err != nil {
+		return nil, err
+	}
+	M := new(bn256.GT).Add(bn256.Pair(CT.C, MPK.U2), new(bn256.GT).Neg(eggs))
+	return M, nil
+}
+
+// keyPart computes e(K,CA*_C^T)/∏(e(Ci,L)e(Kx,Ci'))^{cx} = e(g1,u2)^{alpha*beta}
+// for the rows of CT satisfied by SK.
+func keyPart(CT *ABECiphertext, SK *SK) (*bn256.GT, error) {
 	// find out which attributes are valid and extract them
 	goodMatRows := make([]data.Vector, 0)
 	goodAttribs := make([]string, 0)
-	aToK := make(map[string]*bn256.G2)
+	aToK := make(map[string]*bn256.G1)
 	for at, k := range SK.KXs {
 		aToK[at] = k
 	}
 	for i, at := range CT.MSP.RowToAttrib {
-		if aToK[at] != nil {
+		//Components of another attribute version do not combine
+		if aToK[at] != nil && SK.Versions[at] == CT.Versions[at] {
 			goodMatRows = append(goodMatRows, CT.MSP.Mat[i])
 			goodAttribs = append(goodAttribs, at)
 		}
@@ -325,10 +514,9 @@ func Decrypt(MPK *MPK, CT *ABECiphertext, SK *SK) (*bn256.GT, error) {
 	for _, at := range goodAttribs {
 		if CT.C1[at] != nil && CT.C2[at] != nil && CT.C3[at] != nil {
 			num := bn256.Pair(CT.C1[at], SK.L)
-			num = num.Add(num, bn256.Pair(CT.C2[at], aToK[at]))
+			num = num.Add(num, bn256.Pair(aToK[at], CT.C2[at]))
 			eggLambda[at] = num
 		} else {
-			fmt.Println(CT.C1[at] != nil && CT.C2[at] != nil && CT.C3[at] != nil)
 			return nil, fmt.Errorf("attribute %s not in ciphertext dicts", at)
 		}
 	}
@@ -346,7 +534,10 @@ func Decrypt(MPK *MPK, CT *ABECiphertext, SK *SK) (*bn256.GT, error) {
 			return nil, fmt.Errorf("missing intermediate result")
 		}
 	}
-	eggs = new(bn256.GT).Add(bn256.Pair(SK.K, CT._C), new(bn256.GT).Neg(eggs))
-	M := new(bn256.GT).Add(bn256.Pair(CT.C, MPK.U2), new(bn256.GT).Neg(eggs))
-	return M, nil
+	return new(bn256.GT).Add(bn256.Pair(SK.K, tagged(CT.CA, CT._C, SK.T)), new(bn256.GT).Neg(eggs)), nil
+}
+
+// tagged returns CA*_C^T = g2^{(a+T)beta}, which cancels the 1/(a+T) of K.
+func tagged(CA, _C *bn256.G2, T *big.Int) *bn256.G2 {
+	return new(bn256.G2).Add(CA, new(bn256.G2).ScalarMult(_C, T))
 }
@@ -6,9 +6,11 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/fentec-project/bn256"
 	"github.com/fentec-project/gofe/sample"
 	"github.com/stretchr/testify/require"
 	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/WXY1313/Trade/Crypto/Policy"
 )
 
 func TestAll(t *testing.T) {
@@ -48,3 +50,604 @@ func TestAll(t *testing.T) {
 			ABECT.Message, recoverMessage)
 	}
 }
+
+func TestLargeUniverse(t *testing.T) {
+	MPK, MSK, err := Setup()
+	require.NoError(t, err)
+
+	//Attribute names are arbitrary strings outside any fixed universe
+	SK, err := KeyGen(MPK, MSK, []string{"dept:radiology", "role:doctor", "org:acme-hospital"})
+	require.NoError(t, err)
+
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(MPK, m, "(dept:radiology AND role:doctor) OR dept:finance")
+	require.NoError(t, err)
+	require.True(t, CipherCheck(MPK, ABECT))
+
+	recoverMessage, err := Decrypt(MPK, ABECT, SK)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//A key without a satisfying attribute set must not recover the message
+	SK2, err := KeyGen(MPK, MSK, []string{"role:doctor"})
+	require.NoError(t, err)
+	recoverMessage, err = Decrypt(MPK, ABECT, SK2)
+	require.False(t, err == nil && Operation.GTEqual(ABECT.Message, recoverMessage))
+}
+
+func TestSerialize(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "(Attr1 AND Attr2) OR Attr4")
+	require.NoError(t, err)
+
+	//Round trip every public object and decrypt with the decoded copies
+	enc, err := mpk.Marshal()
+	require.NoError(t, err)
+	MPK2 := new(MPK)
+	require.NoError(t, MPK2.Unmarshal(enc))
+	enc, err = sk.Marshal()
+	require.NoError(t, err)
+	SK2 := new(SK)
+	require.NoError(t, SK2.Unmarshal(enc))
+	enc, err = ABECT.Marshal()
+	require.NoError(t, err)
+	ABECT2 := new(ABECiphertext)
+	require.NoError(t, ABECT2.Unmarshal(enc))
+	require.Nil(t, ABECT2.Message)
+	require.True(t, CipherCheck(MPK2, ABECT2))
+	recoverMessage, err := Decrypt(MPK2, ABECT2, SK2)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//An unreduced x coordinate for Com is rejected
+	bad := append([]byte{}, enc...)
+	for i := 3; i < 3+32; i++ {
+		bad[i] = 0xff
+	}
+	require.Error(t, new(ABECiphertext).Unmarshal(bad))
+	require.Error(t, new(ABECiphertext).Unmarshal(enc[:len(enc)-1]))
+	require.Error(t, new(SK).Unmarshal(enc))
+}
+
+func TestRevokeAttr(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	alice, err := KeyGen(mpk, msk, []string{"dept:finance", "role:manager"})
+	require.NoError(t, err)
+	bob, err := KeyGen(mpk, msk, []string{"dept:finance", "role:manager"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "dept:finance AND role:manager")
+	require.NoError(t, err)
+
+	//Bob loses dept:finance, Alice and the stored ciphertext are updated
+	uk, err := RevokeAttr(mpk, msk, "dept:finance")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), uk.Version)
+	require.False(t, CipherCheck(mpk, ABECT))
+	require.NoError(t, UpdateSK(alice, uk))
+	require.NoError(t, UpdateCiphertext(mpk, ABECT, uk))
+	require.True(t, CipherCheck(mpk, ABECT))
+	//Updates are applied once, in order
+	require.Error(t, UpdateSK(alice, uk))
+	require.Error(t, UpdateCiphertext(mpk, ABECT, uk))
+
+	recoverMessage, err := Decrypt(mpk, ABECT, alice)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	recoverMessage, err = Decrypt(mpk, ABECT, bob)
+	require.False(t, err == nil && Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//New keys and ciphertexts use the new version; a second revocation chains
+	ABECT2, err := Encrypt(mpk, m, "dept:finance OR dept:legal")
+	require.NoError(t, err)
+	require.True(t, CipherCheck(mpk, ABECT2))
+	uk2, err := RevokeAttr(mpk, msk, "dept:finance")
+	require.NoError(t, err)
+	require.NoError(t, UpdateSK(alice, uk2))
+	require.NoError(t, UpdateCiphertext(mpk, ABECT2, uk2))
+	require.True(t, CipherCheck(mpk, ABECT2))
+	recoverMessage, err = Decrypt(mpk, ABECT2, alice)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT2.Message, recoverMessage))
+
+	//Versions survive serialization
+	enc, err := mpk.Marshal()
+	require.NoError(t, err)
+	MPK2 := new(MPK)
+	require.NoError(t, MPK2.Unmarshal(enc))
+	enc, err = ABECT2.Marshal()
+	require.NoError(t, err)
+	ABECT3 := new(ABECiphertext)
+	require.NoError(t, ABECT3.Unmarshal(enc))
+	require.True(t, CipherCheck(MPK2, ABECT3))
+	enc, err = alice.Marshal()
+	require.NoError(t, err)
+	SK2 := new(SK)
+	require.NoError(t, SK2.Unmarshal(enc))
+	recoverMessage, err = Decrypt(MPK2, ABECT3, SK2)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT2.Message, recoverMessage))
+}
+
+func TestOutsource(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "(Attr1 AND Attr2) OR Attr4")
+	require.NoError(t, err)
+
+	TK, z, err := TransformKeyGen(mpk, sk)
+	require.NoError(t, err)
+	//The cloud receives the encoded transformation key only
+	enc, err := TK.Marshal()
+	require.NoError(t, err)
+	TK2 := new(TransformKey)
+	require.NoError(t, TK2.Unmarshal(enc))
+	PT, err := Transform(mpk, ABECT, TK2)
+	require.NoError(t, err)
+	enc, err = PT.Marshal()
+	require.NoError(t, err)
+	PT2 := new(PartialCiphertext)
+	require.NoError(t, PT2.Unmarshal(enc))
+	recoverMessage, err := Retrieve(ABECT, PT2, z)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//A cheating cloud is detected
+	_, err = Retrieve(ABECT, &PartialCiphertext{T0: PT.T0, T1: new(bn256.GT).Add(PT.T1, PT.T0)}, z)
+	require.Error(t, err)
+	m2, _ := sampler.Sample()
+	other, err := Encrypt(mpk, m2, "Attr1")
+	require.NoError(t, err)
+	PT3, err := Transform(mpk, other, TK)
+	require.NoError(t, err)
+	_, err = Retrieve(ABECT, PT3, z)
+	require.Error(t, err)
+	//The transformation key alone does not decrypt
+	recoverMessage, err = Decrypt(mpk, ABECT, &TK.SK)
+	require.NoError(t, err)
+	require.False(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+}
+
+func TestOnlineOffline(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	attrs := []string{"Attr1", "Attr2", "Attr3", "Attr4", "Attr5"}
+
+	off, err := OfflineEncrypt(mpk, m, 5, attrs)
+	require.NoError(t, err)
+	ABECT, err := OnlineEncrypt(mpk, off, "(Attr1 AND Attr2) OR (Attr4 AND Attr5)")
+	require.NoError(t, err)
+	require.True(t, CipherCheck(mpk, ABECT))
+	recoverMessage, err := Decrypt(mpk, ABECT, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	_, err = OnlineEncrypt(mpk, off, "Attr1")
+	require.Error(t, err)
+
+	//Policies outside the precomputed attributes or columns are refused
+	off, err = OfflineEncrypt(mpk, m, 2, attrs)
+	require.NoError(t, err)
+	_, err = OnlineEncrypt(mpk, off, "Attr1 AND Attr6")
+	require.Error(t, err)
+	_, err = OnlineEncrypt(mpk, off, "Attr1 AND Attr2 AND Attr3")
+	require.Error(t, err)
+	//as are precomputations of a revoked attribute version
+	_, err = RevokeAttr(mpk, msk, "Attr1")
+	require.NoError(t, err)
+	_, err = OnlineEncrypt(mpk, off, "Attr1 OR Attr2")
+	require.Error(t, err)
+}
+
+func TestReuse(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	age, err := Policy.NumericAttrs("age", 30)
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, append([]string{"dept:finance"}, age...))
+	require.NoError(t, err)
+	young, err := Policy.NumericAttrs("age", 16)
+	require.NoError(t, err)
+	sk2, err := KeyGen(mpk, msk, append([]string{"dept:finance"}, young...))
+	require.NoError(t, err)
+
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	//The bits of age are used by both comparisons
+	ABECT, err := EncryptReuse(mpk, m, "2 of (dept:finance, role:manager, age >= 18 AND age < 65)")
+	require.NoError(t, err)
+	require.True(t, CipherCheckReuse(mpk, ABECT))
+	recoverMessage, err := DecryptReuse(mpk, ABECT, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	recoverMessage, err = DecryptReuse(mpk, ABECT, sk2)
+	require.False(t, err == nil && Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	enc, err := ABECT.Marshal()
+	require.NoError(t, err)
+	ABECT2 := new(ReuseCiphertext)
+	require.NoError(t, ABECT2.Unmarshal(enc))
+	require.True(t, CipherCheckReuse(mpk, ABECT2))
+	recoverMessage, err = DecryptReuse(mpk, ABECT2, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//Rows sharing an attribute are randomized independently
+	ABECT.C2[1] = ABECT.C2[0]
+	require.False(t, CipherCheckReuse(mpk, ABECT))
+
+	//Random threshold policies
+	sk, err = KeyGen(mpk, msk, []string{"Attr1", "Attr2", "Attr3", "Attr4", "Attr5", "Attr6"})
+	require.NoError(t, err)
+	ABECT, err = EncryptReuse(mpk, m, GenerateThresholdPolicy(6))
+	require.NoError(t, err)
+	require.True(t, CipherCheckReuse(mpk, ABECT))
+	recoverMessage, err = DecryptReuse(mpk, ABECT, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	finance, err := KeyGen(mpk, msk, []string{"dept:finance", "role:manager"})
+	require.NoError(t, err)
+	legal, err := KeyGen(mpk, msk, []string{"dept:legal", "role:manager"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, state, err := EncryptUpdatable(mpk, m, "dept:finance AND role:manager")
+	require.NoError(t, err)
+	com := ABECT.Com
+
+	//The owner adds dept:legal; the server only sees the encoded ciphertext and update key
+	enc, err := ABECT.Marshal()
+	require.NoError(t, err)
+	stored := new(ABECiphertext)
+	require.NoError(t, stored.Unmarshal(enc))
+	uk, state, err := UpdatePolicyKeyGen(mpk, ABECT, state, "(dept:finance OR dept:legal) AND role:manager")
+	require.NoError(t, err)
+	enc, err = uk.Marshal()
+	require.NoError(t, err)
+	uk2 := new(PolicyUpdateKey)
+	require.NoError(t, uk2.Unmarshal(enc))
+	require.NoError(t, UpdatePolicy(stored, uk2))
+	require.True(t, CipherCheck(mpk, stored))
+	require.True(t, Operation.G1Equal(com, stored.Com))
+	for _, sk := range []*SK{finance, legal} {
+		recoverMessage, err := Decrypt(mpk, stored, sk)
+		require.NoError(t, err)
+		require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	}
+
+	//A second update drops dept:finance
+	uk, _, err = UpdatePolicyKeyGen(mpk, stored, state, "dept:legal AND role:manager")
+	require.NoError(t, err)
+	require.NoError(t, UpdatePolicy(stored, uk))
+	require.True(t, CipherCheck(mpk, stored))
+	recoverMessage, err := Decrypt(mpk, stored, legal)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	recoverMessage, err = Decrypt(mpk, stored, finance)
+	require.False(t, err == nil && Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//Only the encryptor knows the sharing vector, which the ciphertext does not carry
+	_, _, err = UpdatePolicyKeyGen(mpk, stored, nil, "dept:legal")
+	require.Error(t, err)
+	_, other, err := EncryptUpdatable(mpk, m, "dept:legal")
+	require.NoError(t, err)
+	_, _, err = UpdatePolicyKeyGen(mpk, stored, other, "dept:legal")
+	require.Error(t, err)
+
+	//An online ciphertext is updated from its offline state
+	off, err := OfflineEncrypt(mpk, m, 2, []string{"dept:finance", "dept:legal", "role:manager"})
+	require.NoError(t, err)
+	online, err := OnlineEncrypt(mpk, off, "dept:finance AND role:manager")
+	require.NoError(t, err)
+	uk, _, err = UpdatePolicyKeyGen(mpk, online, off.UpdateState(), "dept:legal AND role:manager")
+	require.NoError(t, err)
+	require.NoError(t, UpdatePolicy(online, uk))
+	require.True(t, CipherCheck(mpk, online))
+	recoverMessage, err = Decrypt(mpk, online, legal)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(online.Message, recoverMessage))
+}
+
+func TestHidden(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := HiddenKeyGen(mpk, msk, []string{"dept:finance", "org:acme"})
+	require.NoError(t, err)
+	other, err := HiddenKeyGen(mpk, msk, []string{"dept:legal", "org:acme"})
+	require.NoError(t, err)
+
+	//The seller gets the labels through the OPRF, within its quota
+	authorize := HideQuota(map[string]int{"seller": 3})
+	labels := make(map[string]string)
+	for _, at := range []string{"dept:finance", "org:acme", "org:globex"} {
+		blinded, rho, err := HideRequest(mpk, at)
+		require.NoError(t, err)
+		answer, err := HideEvaluate(msk, "seller", blinded, authorize)
+		require.NoError(t, err)
+		labels[at], err = HideFinish(mpk, at, blinded, answer, rho)
+		require.NoError(t, err)
+		label, err := HiddenLabel(msk, at)
+		require.NoError(t, err)
+		require.Equal(t, label, labels[at])
+	}
+	policy, err := HidePolicy("dept:finance AND (org:acme OR org:globex)", labels)
+	require.NoError(t, err)
+	require.NotContains(t, policy, "finance")
+	require.NotContains(t, policy, "acme")
+	require.Contains(t, policy, "dept:")
+
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, policy)
+	require.NoError(t, err)
+	require.True(t, CipherCheck(mpk, ABECT))
+	require.True(t, Match(ABECT, sk))
+	require.False(t, Match(ABECT, other))
+	recoverMessage, err := Decrypt(mpk, ABECT, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//Guessing values is limited to admitted requesters and their quota
+	blinded, rho, err := HideRequest(mpk, "org:acme")
+	require.NoError(t, err)
+	_, err = HideEvaluate(msk, "seller", blinded, authorize)
+	require.Error(t, err)
+	_, err = HideEvaluate(msk, "stranger", blinded, authorize)
+	require.Error(t, err)
+	_, err = HideEvaluate(msk, "seller", blinded, nil)
+	require.Error(t, err)
+
+	//A wrong KGC answer is detected
+	_, err = HideFinish(mpk, "org:acme", blinded, blinded, rho)
+	require.Error(t, err)
+	_, err = HidePolicy("dept:finance AND org:initech", labels)
+	require.Error(t, err)
+	_, err = HiddenLabel(msk, "finance")
+	require.Error(t, err)
+}
+
+func TestTrace(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	keys := make(map[string]*SK)
+	for _, id := range []string{"alice", "bob", "carol"} {
+		keys[id], err = KeyGenID(mpk, msk, id, []string{"Attr1", "Attr2"})
+		require.NoError(t, err)
+	}
+	_, err = KeyGenID(mpk, msk, "", []string{"Attr1"})
+	require.Error(t, err)
+
+	//A traceable key still decrypts, also through its serialization
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "Attr1 AND Attr2")
+	require.NoError(t, err)
+	require.True(t, CipherCheck(mpk, ABECT))
+	data, err := keys["bob"].Marshal()
+	require.NoError(t, err)
+	leaked := new(SK)
+	require.NoError(t, leaked.Unmarshal(data))
+	recoverMessage, err := Decrypt(mpk, ABECT, leaked)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//White-box tracing
+	id, err := Trace(mpk, msk, leaked)
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+	//D only serves delegation, a key stripped of it is still traced
+	stripped := *leaked
+	stripped.D = nil
+	recoverMessage, err = Decrypt(mpk, ABECT, &stripped)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	id, err = Trace(mpk, msk, &stripped)
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+	stripped.D = new(bn256.G1).ScalarBaseMult(big.NewInt(1))
+	id, err = Trace(mpk, msk, &stripped)
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+	require.False(t, KeyCheck(mpk, &stripped))
+	_, err = Delegate(mpk, &stripped, []string{"Attr1"})
+	require.Error(t, err)
+	forged := *leaked
+	forged.T = new(big.Int).Add(leaked.T, big.NewInt(1))
+	_, err = Trace(mpk, msk, &forged)
+	require.Error(t, err)
+	untracked, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2"})
+	require.NoError(t, err)
+	_, err = Trace(mpk, msk, untracked)
+	require.Error(t, err)
+
+	//Black-box tracing of a decoder wrapping the leaked key
+	id, err = TraceBlackBox(mpk, msk, "Attr1 AND Attr2", func(CT *ABECiphertext) (*bn256.GT, error) {
+		return Decrypt(mpk, CT, leaked)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+	_, err = TraceBlackBox(mpk, msk, "Attr1 AND Attr2", func(CT *ABECiphertext) (*bn256.GT, error) {
+		return Decrypt(mpk, CT, untracked)
+	})
+	require.Error(t, err)
+}
+
+func TestThresholdKGC(t *testing.T) {
+	n, threshold := 5, 3
+	mpk, common, err := ThresholdParams()
+	require.NoError(t, err)
+	//Every authority deals, shares[i][j-1] is sent privately to authority j
+	deals := make([]*Deal, n)
+	shares := make([][]*big.Int, n)
+	for i := range deals {
+		deals[i], shares[i], err = DKGDeal(i+1, n, threshold)
+		require.NoError(t, err)
+	}
+	VKs, err := DKGFinish(mpk, deals, n, threshold)
+	require.NoError(t, err)
+	AUs := make([]*Authority, n)
+	for j := range AUs {
+		received := make([]*big.Int, n)
+		for i := range deals {
+			received[i] = shares[i][j]
+		}
+		alpha, err := DKGShare(deals, j+1, received)
+		require.NoError(t, err)
+		AUs[j] = NewAuthority(j+1, common, alpha)
+	}
+	su := []string{"Attr1", "Attr2"}
+	var partials []*PartialKey
+	for _, AU := range AUs {
+		pk, err := PartialKeyGen(mpk, AU, "bob", su)
+		require.NoError(t, err)
+		partials = append(partials, pk)
+	}
+	//Any t partial keys give a working key
+	sk, err := CombineKeys(mpk, VKs, "bob", []*PartialKey{partials[4], partials[1], partials[2]}, threshold)
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "Attr1 AND Attr2")
+	require.NoError(t, err)
+	recoverMessage, err := Decrypt(mpk, ABECT, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	id, err := Trace(mpk, AUs[0].MSK, sk)
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+
+	_, err = CombineKeys(mpk, VKs, "bob", partials[:threshold-1], threshold)
+	require.Error(t, err)
+	_, err = CombineKeys(mpk, VKs, "alice", partials[:threshold], threshold)
+	require.Error(t, err)
+	//A malicious authority is detected
+	bad := *partials[3]
+	bad.K = new(bn256.G1).Add(bad.K, mpk.G1)
+	_, err = CombineKeys(mpk, VKs, "bob", []*PartialKey{partials[0], &bad, partials[2]}, threshold)
+	require.EqualError(t, err, "partial key of authority 4 is invalid")
+
+	//Bad deals and shares are rejected
+	deal, dealt, err := DKGDeal(1, n, threshold)
+	require.NoError(t, err)
+	require.NoError(t, VerifyDeal(deal, n, threshold))
+	require.True(t, VerifyDealShare(deal, 2, dealt[1]))
+	require.False(t, VerifyDealShare(deal, 2, dealt[2]))
+	received := []*big.Int{shares[0][1], dealt[2], shares[2][1], shares[3][1], shares[4][1]}
+	_, err = DKGShare([]*Deal{deals[0], deal, deals[2], deals[3], deals[4]}, 2, received)
+	require.Error(t, err)
+	deal.Commits = append(deal.Commits, deal.Commits[1])
+	require.Error(t, VerifyDeal(deal, n, threshold))
+}
+
+func TestCCA(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2"})
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := EncryptCCA(mpk, m, "Attr1 AND (Attr2 OR Attr3)")
+	require.NoError(t, err)
+	require.True(t, CipherCheck(mpk, ABECT))
+	data, err := ABECT.Marshal()
+	require.NoError(t, err)
+	stored := new(ABECiphertext)
+	require.NoError(t, stored.Unmarshal(data))
+	recoverMessage, err := DecryptCCA(mpk, stored, sk)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+
+	//Mauled ciphertexts decrypt to a wrong message without the check
+	mauled := *stored
+	mauled.C = new(bn256.G1).Add(stored.C, mpk.H1)
+	recoverMessage, err = Decrypt(mpk, &mauled, sk)
+	require.NoError(t, err)
+	require.False(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	_, err = DecryptCCA(mpk, &mauled, sk)
+	require.Error(t, err)
+	mauled = *stored
+	mauled.C1 = map[string]*bn256.G1{"Attr1": new(bn256.G1).Add(stored.C1["Attr1"], mpk.H1), "Attr2": stored.C1["Attr2"], "Attr3": stored.C1["Attr3"]}
+	_, err = DecryptCCA(mpk, &mauled, sk)
+	require.Error(t, err)
+	//Plain ciphertexts are not accepted either
+	ABECT, err = Encrypt(mpk, m, "Attr1 AND Attr2")
+	require.NoError(t, err)
+	_, err = DecryptCCA(mpk, ABECT, sk)
+	require.Error(t, err)
+}
+
+func TestKeyCheck(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGen(mpk, msk, []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	require.True(t, KeyCheck(mpk, sk))
+
+	bad := *sk
+	bad.K = new(bn256.G1).Add(sk.K, mpk.G1)
+	require.False(t, KeyCheck(mpk, &bad))
+	bad = *sk
+	bad.L = new(bn256.G2).Add(sk.L, mpk.G2)
+	require.False(t, KeyCheck(mpk, &bad))
+	bad = *sk
+	bad.KXs = map[string]*bn256.G1{"Attr1": sk.KXs["Attr1"], "Attr2": sk.KXs["Attr3"], "Attr3": sk.KXs["Attr2"]}
+	require.False(t, KeyCheck(mpk, &bad))
+
+	//A key for a revoked attribute version fails until it is updated
+	uk, err := RevokeAttr(mpk, msk, "Attr2")
+	require.NoError(t, err)
+	require.False(t, KeyCheck(mpk, sk))
+	require.NoError(t, UpdateSK(sk, uk))
+	require.True(t, KeyCheck(mpk, sk))
+}
+
+func TestDelegate(t *testing.T) {
+	mpk, msk, err := Setup()
+	require.NoError(t, err)
+	sk, err := KeyGenID(mpk, msk, "acme", []string{"Attr1", "Attr2", "Attr3"})
+	require.NoError(t, err)
+	employee, err := Delegate(mpk, sk, []string{"Attr1", "Attr2"})
+	require.NoError(t, err)
+	require.True(t, KeyCheck(mpk, employee))
+	require.False(t, Operation.G1Equal(sk.K, employee.K))
+	intern, err := Delegate(mpk, employee, []string{"Attr1"})
+	require.NoError(t, err)
+	require.True(t, KeyCheck(mpk, intern))
+	_, err = Delegate(mpk, employee, []string{"Attr3"})
+	require.Error(t, err)
+
+	sampler := sample.NewUniformRange(big.NewInt(1), mpk.Order)
+	m, _ := sampler.Sample()
+	ABECT, err := Encrypt(mpk, m, "Attr1 AND Attr2")
+	require.NoError(t, err)
+	recoverMessage, err := Decrypt(mpk, ABECT, employee)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(ABECT.Message, recoverMessage))
+	_, err = Decrypt(mpk, ABECT, intern)
+	require.Error(t, err)
+
+	//Delegated keys trace to the delegator
+	id, err := Trace(mpk, msk, intern)
+	require.NoError(t, err)
+	require.Equal(t, "acme", id)
+}
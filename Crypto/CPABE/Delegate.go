@@ -0,0 +1,51 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Delegate derives a key for a subset of the attributes of sk without the
+// KGC, e.g. for the employees of a buyer company. With a fresh t' it sets
+//
+//	K' = K·D^{t'}, L' = L·g2^{t'}, Kx' = Kx·PK_x^{t'},
+//
+// a key for t+t' that is independent of sk apart from its tag T, so
+// delegated keys still trace to the holder of sk. The attributes of the
+// subset must be at their current version; update sk with UpdateSK first.
+func Delegate(MPK *MPK, sk *SK, subset []string) (*SK, error) {
+	if sk.D == nil || sk.T == nil {
+		return nil, fmt.Errorf("the key cannot be delegated")
+	}
+	//e(D,g2^a*g2^T) = e(h1,g2)
+	aT := new(bn256.G2).Add(MPK.AG2, new(bn256.G2).ScalarMult(MPK.G2, sk.T))
+	if !Operation.GTEqual(bn256.Pair(sk.D, aT), bn256.Pair(MPK.H1, MPK.G2)) {
+		return nil, fmt.Errorf("the delegation part of the key is invalid")
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	t, _ := sampler.Sample()
+	out := &SK{
+		K:        new(bn256.G1).Add(sk.K, new(bn256.G1).ScalarMult(sk.D, t)),
+		L:        new(bn256.G2).Add(sk.L, new(bn256.G2).ScalarMult(MPK.G2, t)),
+		T:        sk.T,
+		D:        sk.D,
+		KXs:      make(map[string]*bn256.G1),
+		Versions: make(map[string]uint64),
+	}
+	for _, at := range subset {
+		kx := sk.KXs[at]
+		if kx == nil {
+			return nil, fmt.Errorf("attribute %s not in the key", at)
+		}
+		if sk.Versions[at] != MPK.Versions[at] {
+			return nil, fmt.Errorf("attribute %s of the key is at version %d, not %d", at, sk.Versions[at], MPK.Versions[at])
+		}
+		out.KXs[at] = new(bn256.G1).Add(kx, new(bn256.G1).ScalarMult(AttrElement(MPK, at), t))
+		out.Versions[at] = sk.Versions[at]
+	}
+	return out, nil
+}
@@ -0,0 +1,171 @@
+package CPABE
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Partially hidden policies. An attribute "category:value" is replaced by the
+// label "category:token" with token = SHA256(x, F(x))[:16] and
+// F(x) = H'(x)^κ an oblivious PRF under the KGC key κ. Keys and ciphertexts
+// are built over the labels as usual, so a policy only reveals categories:
+// a guessed value can only be checked against a label with F of the guess.
+//
+// The KGC puts labels straight into keys with HiddenKeyGen. An encryptor gets
+// the label of x without revealing x: it sends HideRequest's blinded element
+// to the KGC, which answers with HideEvaluate, and HideFinish checks the
+// answer against g2^κ and unblinds it. Every answer is one guess checked, e.g.
+// "competitor:acme" against a published policy, so HideEvaluate only serves
+// requesters its HideAuthorizer admits, and the authorizer must authenticate
+// them and limit their number of requests. Hiding holds against everyone
+// else, and against an admitted requester for the values it did not try.
+
+// HiddenLabel is the label of attribute at, computed with the KGC key.
+func HiddenLabel(MSK *MSK, at string) (string, error) {
+	hx, err := oprfElement(at)
+	if err != nil {
+		return "", err
+	}
+	return hiddenLabel(at, new(bn256.G1).ScalarMult(hx, MSK.Kappa)), nil
+}
+
+// HiddenKeyGen issues a key for the labels of attributes su.
+func HiddenKeyGen(MPK *MPK, MSK *MSK, su []string) (*SK, error) {
+	labels := make([]string, len(su))
+	for i, at := range su {
+		var err error
+		if labels[i], err = HiddenLabel(MSK, at); err != nil {
+			return nil, err
+		}
+	}
+	return KeyGen(MPK, MSK, labels)
+}
+
+// HideRequest blinds attribute at for the KGC. rho must be kept for
+// HideFinish.
+func HideRequest(MPK *MPK, at string) (*bn256.G1, *big.Int, error) {
+	hx, err := oprfElement(at)
+	if err != nil {
+		return nil, nil, err
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	rho, _ := sampler.Sample()
+	return new(bn256.G1).ScalarMult(hx, rho), rho, nil
+}
+
+// HideAuthorizer admits one evaluation for requester or returns why not. It
+// must authenticate requester and rate limit it, see HideQuota.
+type HideAuthorizer func(requester string) error
+
+// HideQuota admits every requester in quota for as many evaluations in total.
+func HideQuota(quota map[string]int) HideAuthorizer {
+	var mu sync.Mutex
+	return func(requester string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if quota[requester] <= 0 {
+			return fmt.Errorf("requester %s has no label evaluations left", requester)
+		}
+		quota[requester]--
+		return nil
+	}
+}
+
+// HideEvaluate is run by the KGC on a blinded request of an authenticated
+// requester; it learns nothing about the attribute. The request is refused
+// unless authorize admits requester, and a nil authorize refuses all.
+func HideEvaluate(MSK *MSK, requester string, blinded *bn256.G1, authorize HideAuthorizer) (*bn256.G1, error) {
+	if authorize == nil {
+		return nil, fmt.Errorf("no authorizer for label evaluations")
+	}
+	if blinded == nil {
+		return nil, fmt.Errorf("empty label request")
+	}
+	if err := authorize(requester); err != nil {
+		return nil, err
+	}
+	return new(bn256.G1).ScalarMult(blinded, MSK.Kappa), nil
+}
+
+// HideFinish checks the KGC's answer to the request (blinded, rho) for at and
+// returns the label of at.
+func HideFinish(MPK *MPK, at string, blinded, answer *bn256.G1, rho *big.Int) (string, error) {
+	if _, err := oprfElement(at); err != nil {
+		return "", err
+	}
+	if !Operation.GTEqual(bn256.Pair(answer, MPK.G2), bn256.Pair(blinded, MPK.KappaG2)) {
+		return "", fmt.Errorf("invalid OPRF answer for attribute %s", at)
+	}
+	rhoInv := new(big.Int).ModInverse(rho, MPK.Order)
+	return hiddenLabel(at, new(bn256.G1).ScalarMult(answer, rhoInv)), nil
+}
+
+// HidePolicy replaces the attributes of a boolean policy by their labels.
+func HidePolicy(policy string, labels map[string]string) (string, error) {
+	var out strings.Builder
+	word := func(w string) error {
+		if w == "" || w == "AND" || w == "OR" {
+			out.WriteString(w)
+			return nil
+		}
+		label, ok := labels[w]
+		if !ok {
+			return fmt.Errorf("no label for attribute %s", w)
+		}
+		out.WriteString(label)
+		return nil
+	}
+	start := 0
+	for i, c := range policy {
+		if c == ' ' || c == '(' || c == ')' {
+			if err := word(policy[start:i]); err != nil {
+				return "", err
+			}
+			out.WriteRune(c)
+			start = i + 1
+		}
+	}
+	if err := word(policy[start:]); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Match tells whether SK satisfies the policy of CT, using only linear algebra
+// on the public MSP. Buyers use it to find the ciphertexts worth decrypting.
+func Match(CT *ABECiphertext, SK *SK) bool {
+	var rows []int
+	for i, at := range CT.MSP.RowToAttrib {
+		if SK.KXs[at] != nil && SK.Versions[at] == CT.Versions[at] {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) == 0 {
+		return false
+	}
+	_, err := rowCoeffs(CT.MSP, rows)
+	return err == nil
+}
+
+func oprfElement(at string) (*bn256.G1, error) {
+	if i := strings.Index(at, ":"); i <= 0 || i == len(at)-1 {
+		return nil, fmt.Errorf("attribute %s is not of the form category:value", at)
+	}
+	return bn256.HashG1("CPABE:oprf:" + at)
+}
+
+func hiddenLabel(at string, fx *bn256.G1) string {
+	category := at[:strings.Index(at, ":")]
+	h := sha256.New()
+	h.Write([]byte(at))
+	h.Write(fx.Marshal())
+	return category + ":" + hex.EncodeToString(h.Sum(nil)[:16])
+}
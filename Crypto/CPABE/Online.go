@@ -0,0 +1,147 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Online/offline encryption. The offline phase fixes the message, a random
+// sharing vector v with v[0] = beta and, for every attribute the policy may
+// use, a random ri, and precomputes all exponentiations:
+//
+//	h1^{vj}, h1^{vj/beta}, PK_x^{-rx}, g2^{rx}, C, _C, Com and Message.
+//
+// Once the policy is known its MSP rows only have small entries, so
+// h1^{λi} = ∏ (h1^{vj})^{Mij} and h1^{λi/beta} are formed with a handful of
+// group additions and no exponentiation.
+
+// OfflineCT holds the precomputed parts of one ciphertext. It can be bound to
+// a single policy only.
+type OfflineCT struct {
+	ct   *ABECiphertext // message and beta parts
+	h    []*bn256.G1    // h[j] = h1^{vj}
+	hInv []*bn256.G1    // hInv[j] = h1^{vj/beta}
+	v    data.Vector
+	c1   map[string]*bn256.G1
+	c2   map[string]*bn256.G2
+	used bool
+}
+
+// OfflineEncrypt precomputes a ciphertext of m for any policy with at most
+// cols MSP columns over the attributes attrs.
+func OfflineEncrypt(MPK *MPK, m *big.Int, cols int, attrs []string) (*OfflineCT, error) {
+	if cols < 1 {
+		return nil, fmt.Errorf("an offline ciphertext needs at least one column")
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	v, err := data.NewRandomVector(cols, sampler)
+	if err != nil {
+		return nil, err
+	}
+	beta := v[0]
+	betaInv := new(big.Int).ModInverse(beta, MPK.Order)
+	M := bn256.Pair(new(bn256.G1).ScalarMult(MPK.H1, m), MPK.U2)
+	off := &OfflineCT{
+		ct: &ABECiphertext{
+			Message: M,
+			Com:     new(bn256.G1).ScalarBaseMult(m),
+			C:       new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, m), new(bn256.G1).ScalarMult(MPK.AlphaG1, beta)),
+			_C:      new(bn256.G2).ScalarMult(MPK.G2, beta),
+			CA:      new(bn256.G2).ScalarMult(MPK.AG2, beta),
+			Tag:     MessageTag(M),
+			// Versions of the precomputed attribute elements
+			Versions: make(map[string]uint64),
+		},
+		h:    make([]*bn256.G1, cols),
+		hInv: make([]*bn256.G1, cols),
+		c1:   make(map[string]*bn256.G1),
+		c2:   make(map[string]*bn256.G2),
+		v:    v,
+	}
+	for j := range v {
+		off.h[j] = new(bn256.G1).ScalarMult(MPK.H1, v[j])
+		vb := new(big.Int).Mul(v[j], betaInv)
+		off.hInv[j] = new(bn256.G1).ScalarMult(MPK.H1, vb.Mod(vb, MPK.Order))
+	}
+	for _, at := range attrs {
+		if at == "" {
+			return nil, fmt.Errorf("empty attribute name")
+		}
+		r, _ := sampler.Sample()
+		off.c1[at] = new(bn256.G1).Neg(new(bn256.G1).ScalarMult(AttrElement(MPK, at), r))
+		off.c2[at] = new(bn256.G2).ScalarMult(MPK.G2, r)
+		off.ct.Versions[at] = MPK.Versions[at]
+	}
+	return off, nil
+}
+
+// Com returns the commitment g1^m of the precomputed ciphertext.
+func (off *OfflineCT) Com() *bn256.G1 {
+	return off.ct.Com
+}
+
+// UpdateState returns the encryptor's state for UpdatePolicyKeyGen on the
+// ciphertext bound from off.
+func (off *OfflineCT) UpdateState() *UpdateState {
+	return &UpdateState{v: off.v}
+}
+
+// OnlineEncrypt binds an offline ciphertext to policy. The offline ciphertext
+// is consumed; binding it twice would reuse its randomness.
+func OnlineEncrypt(MPK *MPK, off *OfflineCT, policy string) (*ABECiphertext, error) {
+	if off.used {
+		return nil, fmt.Errorf("offline ciphertext already used")
+	}
+	msp, err := policyMSP(policy)
+	if err != nil {
+		return nil, err
+	}
+	if msp.Mat.Cols() > len(off.h) {
+		return nil, fmt.Errorf("policy needs %d columns, offline ciphertext has %d", msp.Mat.Cols(), len(off.h))
+	}
+	for _, at := range msp.RowToAttrib {
+		if off.c1[at] == nil {
+			return nil, fmt.Errorf("attribute %s was not precomputed", at)
+		}
+		if off.ct.Versions[at] != MPK.Versions[at] {
+			return nil, fmt.Errorf("attribute %s was precomputed for an old version", at)
+		}
+	}
+	off.used = true
+
+	ct := *off.ct
+	ct.MSP = msp
+	ct.C1 = make(map[string]*bn256.G1)
+	ct.C2 = make(map[string]*bn256.G2)
+	ct.C3 = make(map[string]*bn256.G1)
+	ct.Versions = make(map[string]uint64)
+	for i, at := range msp.RowToAttrib {
+		ct.C1[at] = new(bn256.G1).Add(rowCombine(off.h, msp.Mat[i]), off.c1[at])
+		ct.C2[at] = off.c2[at]
+		ct.C3[at] = rowCombine(off.hInv, msp.Mat[i])
+		ct.Versions[at] = off.ct.Versions[at]
+	}
+	return &ct, nil
+}
+
+// rowCombine returns ∏ points[j]^{row[j]}, adding points directly for the
+// entries 0 and ±1 produced by BooleanToMSP.
+func rowCombine(points []*bn256.G1, row data.Vector) *bn256.G1 {
+	sum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for j, x := range row {
+		switch {
+		case x.Sign() == 0:
+		case x.IsInt64() && x.Int64() == 1:
+			sum.Add(sum, points[j])
+		case x.IsInt64() && x.Int64() == -1:
+			sum.Add(sum, new(bn256.G1).Neg(points[j]))
+		default:
+			sum.Add(sum, new(bn256.G1).ScalarMult(points[j], new(big.Int).Mod(x, bn256.Order)))
+		}
+	}
+	return sum
+}
@@ -0,0 +1,79 @@
+package CPABE
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Outsourced decryption in the style of Green, Hohenberger and Waters. The
+// buyer blinds SK with a random z into a transformation key TK = SK^{1/z}
+// that can be handed to an untrusted cloud. Transform does all pairings and
+// returns T0 = e(C,u2) and T1 = e(g1,u2)^{alpha*beta/z}; the buyer recovers
+// M = T0/T1^z with one exponentiation and checks it against the ciphertext tag.
+
+// TransformKey is a blinded attribute key. It is encoded like an SK.
+type TransformKey struct {
+	SK
+}
+
+// PartialCiphertext is the output of Transform.
+type PartialCiphertext struct {
+	T0 *bn256.GT // e(C,u2)
+	T1 *bn256.GT // e(g1,u2)^{alpha*beta/z}
+}
+
+// MessageTag is the SHA256 tag of a message stored in ABECiphertext.Tag.
+func MessageTag(M *bn256.GT) []byte {
+	tag := sha256.Sum256(M.Marshal())
+	return tag[:]
+}
+
+// TransformKeyGen blinds sk and returns the transformation key together with
+// the retrieval key z the buyer keeps.
+func TransformKeyGen(MPK *MPK, sk *SK) (*TransformKey, *big.Int, error) {
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	z, _ := sampler.Sample()
+	zInv := new(big.Int).ModInverse(z, MPK.Order)
+	kxs := make(map[string]*bn256.G1)
+	versions := make(map[string]uint64)
+	for at, kx := range sk.KXs {
+		kxs[at] = new(bn256.G1).ScalarMult(kx, zInv)
+		versions[at] = sk.Versions[at]
+	}
+	return &TransformKey{SK{
+		K:        new(bn256.G1).ScalarMult(sk.K, zInv),
+		L:        new(bn256.G2).ScalarMult(sk.L, zInv),
+		T:        sk.T,
+		D:        new(bn256.G1).ScalarMult(sk.D, zInv),
+		KXs:      kxs,
+		Versions: versions,
+	}}, z, nil
+}
+
+// Transform partially decrypts CT with a transformation key. It learns
+// nothing about the message.
+func Transform(MPK *MPK, CT *ABECiphertext, TK *TransformKey) (*PartialCiphertext, error) {
+	t1, err := keyPart(CT, &TK.SK)
+	if err != nil {
+		return nil, err
+	}
+	return &PartialCiphertext{T0: bn256.Pair(CT.C, MPK.U2), T1: t1}, nil
+}
+
+// Retrieve finishes an outsourced decryption with the retrieval key z. A
+// partial ciphertext that was not computed honestly from CT is rejected.
+func Retrieve(CT *ABECiphertext, PT *PartialCiphertext, z *big.Int) (*bn256.GT, error) {
+	if PT.T0 == nil || PT.T1 == nil {
+		return nil, fmt.Errorf("incomplete partial ciphertext")
+	}
+	M := new(bn256.GT).Add(PT.T0, new(bn256.GT).Neg(new(bn256.GT).ScalarMult(PT.T1, z)))
+	if len(CT.Tag) == 0 || subtle.ConstantTimeCompare(MessageTag(M), CT.Tag) != 1 {
+		return nil, fmt.Errorf("partial ciphertext does not match the ciphertext tag")
+	}
+	return M, nil
+}
@@ -0,0 +1,130 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Policy update. The encryptor reshares the same beta over the new policy,
+// λi' = Mi'·v' with v'[0] = beta, so C, _C and Com are untouched. Rows of
+// attributes kept from the old policy are shifted by h1^{λi'-λi} and
+// h1^{(λi'-λi)/beta} and keep their ri; rows of new attributes are encrypted
+// afresh; rows of dropped attributes are deleted. A server holding the
+// ciphertext applies the update key without learning anything about m.
+
+// UpdateState is what the encryptor keeps to update the policy of a
+// ciphertext: its sharing vector v. Since v[0] = beta strips C down to h1^m
+// it must never be stored with the ciphertext.
+type UpdateState struct {
+	v data.Vector
+}
+
+// PolicyUpdateKey moves an ABECiphertext to a new policy.
+type PolicyUpdateKey struct {
+	Policy   string
+	MSP      *abe.MSP
+	D1       map[string]*bn256.G1 // D1[x] = h1^{λx'-λx} for kept attributes
+	D3       map[string]*bn256.G1 // D3[x] = h1^{(λx'-λx)/beta}
+	C1       map[string]*bn256.G1 // rows of new attributes, as in Encrypt
+	C2       map[string]*bn256.G2
+	C3       map[string]*bn256.G1
+	Versions map[string]uint64 // versions of the new rows
+}
+
+// UpdatePolicyKeyGen creates the key moving CT to policy from the encryptor's
+// state, and returns the state for the updated ciphertext.
+func UpdatePolicyKeyGen(MPK *MPK, CT *ABECiphertext, state *UpdateState, policy string) (*PolicyUpdateKey, *UpdateState, error) {
+	if state == nil || len(state.v) < CT.MSP.Mat.Cols() || state.v[0] == nil {
+		return nil, nil, fmt.Errorf("the sharing vector of the ciphertext is unknown")
+	}
+	beta := state.v[0]
+	if !Operation.G2Equal(new(bn256.G2).ScalarMult(MPK.G2, beta), CT._C) {
+		return nil, nil, fmt.Errorf("the update state does not belong to the ciphertext")
+	}
+	msp, err := policyMSP(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	betaInv := new(big.Int).ModInverse(beta, MPK.Order)
+	v, err := data.NewRandomVector(msp.Mat.Cols(), sampler)
+	if err != nil {
+		return nil, nil, err
+	}
+	v[0] = beta
+	old := make(map[string]*big.Int)
+	for i, at := range CT.MSP.RowToAttrib {
+		old[at] = mspShare(CT.MSP.Mat[i], state.v)
+	}
+
+	uk := &PolicyUpdateKey{
+		Policy:   policy,
+		MSP:      msp,
+		D1:       make(map[string]*bn256.G1),
+		D3:       make(map[string]*bn256.G1),
+		C1:       make(map[string]*bn256.G1),
+		C2:       make(map[string]*bn256.G2),
+		C3:       make(map[string]*bn256.G1),
+		Versions: make(map[string]uint64),
+	}
+	for i, at := range msp.RowToAttrib {
+		lambda := mspShare(msp.Mat[i], v)
+		if prev, ok := old[at]; ok {
+			delta := new(big.Int).Sub(lambda, prev)
+			delta.Mod(delta, MPK.Order)
+			uk.D1[at] = new(bn256.G1).ScalarMult(MPK.H1, delta)
+			delta.Mul(delta, betaInv)
+			uk.D3[at] = new(bn256.G1).ScalarMult(MPK.H1, delta.Mod(delta, MPK.Order))
+			continue
+		}
+		r, _ := sampler.Sample()
+		uk.C1[at] = new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, lambda), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(AttrElement(MPK, at), r)))
+		uk.C2[at] = new(bn256.G2).ScalarMult(MPK.G2, r)
+		result := new(big.Int).Mul(lambda, betaInv)
+		uk.C3[at] = new(bn256.G1).ScalarMult(MPK.H1, result.Mod(result, MPK.Order))
+		uk.Versions[at] = MPK.Versions[at]
+	}
+	return uk, &UpdateState{v: v}, nil
+}
+
+// UpdatePolicy applies uk to CT in place.
+func UpdatePolicy(CT *ABECiphertext, uk *PolicyUpdateKey) error {
+	c1 := make(map[string]*bn256.G1)
+	c2 := make(map[string]*bn256.G2)
+	c3 := make(map[string]*bn256.G1)
+	versions := make(map[string]uint64)
+	for _, at := range uk.MSP.RowToAttrib {
+		if uk.D1[at] != nil {
+			if CT.C1[at] == nil || CT.C2[at] == nil || CT.C3[at] == nil || uk.D3[at] == nil {
+				return fmt.Errorf("attribute %s not in ciphertext dicts", at)
+			}
+			c1[at] = new(bn256.G1).Add(CT.C1[at], uk.D1[at])
+			c2[at] = CT.C2[at]
+			c3[at] = new(bn256.G1).Add(CT.C3[at], uk.D3[at])
+			versions[at] = CT.Versions[at]
+			continue
+		}
+		if uk.C1[at] == nil || uk.C2[at] == nil || uk.C3[at] == nil {
+			return fmt.Errorf("attribute %s not in update key", at)
+		}
+		c1[at], c2[at], c3[at] = uk.C1[at], uk.C2[at], uk.C3[at]
+		versions[at] = uk.Versions[at]
+	}
+	CT.MSP, CT.C1, CT.C2, CT.C3, CT.Versions = uk.MSP, c1, c2, c3, versions
+	return nil
+}
+
+// mspShare returns row·v mod p.
+func mspShare(row, v data.Vector) *big.Int {
+	sum := big.NewInt(0)
+	for j, x := range row {
+		sum.Add(sum, new(big.Int).Mul(x, v[j]))
+	}
+	return sum.Mod(sum, bn256.Order)
+}
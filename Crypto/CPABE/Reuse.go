@@ -0,0 +1,158 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/WXY1313/Trade/Crypto/Policy"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// ReuseCiphertext is an ABECiphertext for policies of the Policy compiler,
+// which may use an attribute in several MSP rows. Its components are indexed
+// by row and every row i has its own ri, so rows sharing an attribute are
+// still independently randomized.
+type ReuseCiphertext struct {
+	Message  *bn256.GT
+	Com      *bn256.G1   // Com = g1^m
+	MSP      *abe.MSP    // (M, ρ)
+	C        *bn256.G1   //C=h1^m*g1^{alpha*beta}
+	_C       *bn256.G2   //_C=g2^{beta}
+	CA       *bn256.G2   //CA=g2^{a*beta}
+	C1       []*bn256.G1 //Ci  = h1^{λi}PK_ρ(i)^{-ri}
+	C2       []*bn256.G2 //Ci' = g2^{ri}
+	C3       []*bn256.G1 //Ci''=h1^{λi/beta}
+	Versions map[string]uint64
+	Tag      []byte
+}
+
+// EncryptReuse encrypts m under a policy of the Policy compiler, e.g.
+// "2 of (dept:finance, role:manager, age >= 18)".
+func EncryptReuse(MPK *MPK, m *big.Int, policy string) (*ReuseCiphertext, error) {
+	msp, err := Policy.Compile(policy)
+	if err != nil {
+		return nil, err
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	v, err := data.NewRandomVector(msp.Mat.Cols(), sampler)
+	if err != nil {
+		return nil, err
+	}
+	beta := v[0]
+	betaInv := new(big.Int).ModInverse(beta, MPK.Order)
+	M := bn256.Pair(new(bn256.G1).ScalarMult(MPK.H1, m), MPK.U2)
+	ct := &ReuseCiphertext{
+		Message:  M,
+		Com:      new(bn256.G1).ScalarBaseMult(m),
+		MSP:      msp,
+		C:        new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, m), new(bn256.G1).ScalarMult(MPK.AlphaG1, beta)),
+		_C:       new(bn256.G2).ScalarMult(MPK.G2, beta),
+		CA:       new(bn256.G2).ScalarMult(MPK.AG2, beta),
+		C1:       make([]*bn256.G1, len(msp.Mat)),
+		C2:       make([]*bn256.G2, len(msp.Mat)),
+		C3:       make([]*bn256.G1, len(msp.Mat)),
+		Versions: make(map[string]uint64),
+		Tag:      MessageTag(M),
+	}
+	for i, at := range msp.RowToAttrib {
+		lambda, err := msp.Mat[i].Dot(v)
+		if err != nil {
+			return nil, err
+		}
+		lambda.Mod(lambda, MPK.Order)
+		r, _ := sampler.Sample()
+		ct.C1[i] = new(bn256.G1).Add(new(bn256.G1).ScalarMult(MPK.H1, lambda), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(AttrElement(MPK, at), r)))
+		ct.C2[i] = new(bn256.G2).ScalarMult(MPK.G2, r)
+		result := new(big.Int).Mul(lambda, betaInv)
+		ct.C3[i] = new(bn256.G1).ScalarMult(MPK.H1, result.Mod(result, MPK.Order))
+		ct.Versions[at] = MPK.Versions[at]
+	}
+	return ct, nil
+}
+
+// CipherCheckReuse is CipherCheck for ReuseCiphertext.
+func CipherCheckReuse(mpk *MPK, ct *ReuseCiphertext) bool {
+	rows := len(ct.MSP.Mat)
+	if rows == 0 || len(ct.C1) != rows || len(ct.C2) != rows || len(ct.C3) != rows {
+		return false
+	}
+	if !Operation.GTEqual(bn256.Pair(ct.C, mpk.G2), new(bn256.GT).Add(bn256.Pair(ct.Com, mpk.H2), bn256.Pair(mpk.AlphaG1, ct._C))) {
+		return false
+	}
+	if !Operation.GTEqual(bn256.Pair(mpk.G1, ct.CA), bn256.Pair(mpk.AG1, ct._C)) {
+		return false
+	}
+	all := make([]int, rows)
+	for i, at := range ct.MSP.RowToAttrib {
+		all[i] = i
+		if ct.C1[i] == nil || ct.C2[i] == nil || ct.C3[i] == nil {
+			return false
+		}
+		if ct.Versions[at] != mpk.Versions[at] {
+			return false
+		}
+		if !Operation.GTEqual(bn256.Pair(ct.C1[i], mpk.G2), new(bn256.GT).Add(bn256.Pair(ct.C3[i], ct._C), bn256.Pair(new(bn256.G1).Neg(AttrElement(mpk, at)), ct.C2[i]))) {
+			return false
+		}
+	}
+	//∑ci·Ci'' = h1 for coefficients ci over all rows
+	c, err := rowCoeffs(ct.MSP, all)
+	if err != nil {
+		return false
+	}
+	recon := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for i := range all {
+		recon.Add(recon, new(bn256.G1).ScalarMult(ct.C3[i], c[i]))
+	}
+	return Operation.G1Equal(mpk.H1, recon)
+}
+
+// DecryptReuse is Decrypt for ReuseCiphertext.
+func DecryptReuse(MPK *MPK, CT *ReuseCiphertext, SK *SK) (*bn256.GT, error) {
+	var good []int
+	for i, at := range CT.MSP.RowToAttrib {
+		if SK.KXs[at] != nil && SK.Versions[at] == CT.Versions[at] {
+			good = append(good, i)
+		}
+	}
+	if len(good) == 0 {
+		return nil, fmt.Errorf("the key contains no attribute of the policy")
+	}
+	if len(CT.C1) != len(CT.MSP.Mat) || len(CT.C2) != len(CT.MSP.Mat) {
+		return nil, fmt.Errorf("ciphertext rows do not match the MSP")
+	}
+	c, err := rowCoeffs(CT.MSP, good)
+	if err != nil {
+		return nil, err
+	}
+	eggs := new(bn256.GT).ScalarBaseMult(big.NewInt(0))
+	for k, i := range good {
+		num := bn256.Pair(CT.C1[i], SK.L)
+		num.Add(num, bn256.Pair(SK.KXs[CT.MSP.RowToAttrib[i]], CT.C2[i]))
+		eggs.Add(eggs, new(bn256.GT).ScalarMult(num, c[k]))
+	}
+	eggs = new(bn256.GT).Add(bn256.Pair(SK.K, tagged(CT.CA, CT._C, SK.T)), new(bn256.GT).Neg(eggs))
+	return new(bn256.GT).Add(bn256.Pair(CT.C, MPK.U2), new(bn256.GT).Neg(eggs)), nil
+}
+
+// rowCoeffs returns c with ∑c[k]·Mat[rows[k]] = (1,0,...,0), reduced mod p.
+func rowCoeffs(msp *abe.MSP, rows []int) ([]*big.Int, error) {
+	mat := make(data.Matrix, len(rows))
+	for k, i := range rows {
+		mat[k] = msp.Mat[i]
+	}
+	one := data.NewConstantVector(msp.Mat.Cols(), big.NewInt(0))
+	one[0] = big.NewInt(1)
+	c, err := data.GaussianEliminationSolver(mat.Transpose(), one, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	for k := range c {
+		c[k].Mod(c[k], bn256.Order)
+	}
+	return c, nil
+}
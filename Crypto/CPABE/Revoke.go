@@ -0,0 +1,107 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Attribute revocation. Every attribute x has a secret version key vx (1 until
+// x is first revoked) and a public element PK_x = H(x)^vx. Keys hold
+// Kx = PK_x^t and ciphertexts Ci = h1^{λi}·PK_x^{-ri}, Ci' = g2^{ri}.
+//
+// Revoking x picks a fresh version key vx' and publishes PK_x' = H(x)^vx'.
+// The update key f = vx'/vx goes to the holders that keep x, who replace Kx by
+// Kx^f, and to the party storing the ciphertexts, which replaces Ci' by
+// Ci'^{1/f} without decrypting: PK_x'^{-ri/f} = PK_x^{-ri}, so Ci and Ci''
+// stay as they are and CipherCheck accepts the result under the new MPK.
+// Revoked holders must not receive f.
+
+// UpdateKey moves keys and ciphertexts of attribute Attr from version
+// Version-1 to Version.
+type UpdateKey struct {
+	Attr    string
+	Version uint64
+	Factor  *big.Int // vx'/vx
+}
+
+// AttrElement returns PK_x, the element of the current version of attribute at.
+func AttrElement(MPK *MPK, at string) *bn256.G1 {
+	if pk := MPK.AttrPKs[at]; pk != nil {
+		return pk
+	}
+	return HashAttr(at)
+}
+
+// RevokeAttr moves attribute at to a new version, updating MPK and MSK in
+// place, and returns the update key for the remaining holders.
+func RevokeAttr(MPK *MPK, MSK *MSK, at string) (*UpdateKey, error) {
+	if at == "" {
+		return nil, fmt.Errorf("empty attribute name")
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	v := MSK.Versions[at]
+	if v == nil {
+		v = big.NewInt(1)
+	}
+	v2, _ := sampler.Sample()
+	factor := new(big.Int).ModInverse(v, MPK.Order)
+	factor.Mul(factor, v2)
+	factor.Mod(factor, MPK.Order)
+
+	if MSK.Versions == nil {
+		MSK.Versions = make(map[string]*big.Int)
+	}
+	if MPK.AttrPKs == nil {
+		MPK.AttrPKs = make(map[string]*bn256.G1)
+	}
+	if MPK.Versions == nil {
+		MPK.Versions = make(map[string]uint64)
+	}
+	MSK.Versions[at] = v2
+	MPK.AttrPKs[at] = new(bn256.G1).ScalarMult(HashAttr(at), v2)
+	MPK.Versions[at]++
+	return &UpdateKey{Attr: at, Version: MPK.Versions[at], Factor: factor}, nil
+}
+
+// UpdateSK moves the component of SK for uk.Attr to the new version.
+func UpdateSK(SK *SK, uk *UpdateKey) error {
+	kx := SK.KXs[uk.Attr]
+	if kx == nil {
+		return fmt.Errorf("key has no attribute %s", uk.Attr)
+	}
+	if SK.Versions[uk.Attr]+1 != uk.Version {
+		return fmt.Errorf("attribute %s of the key is at version %d, update key is for version %d", uk.Attr, SK.Versions[uk.Attr], uk.Version)
+	}
+	if SK.Versions == nil {
+		SK.Versions = make(map[string]uint64)
+	}
+	SK.KXs[uk.Attr] = new(bn256.G1).ScalarMult(kx, uk.Factor)
+	SK.Versions[uk.Attr] = uk.Version
+	return nil
+}
+
+// UpdateCiphertext re-randomizes the row of CT labelled uk.Attr for the new
+// attribute version. Ciphertexts whose policy does not mention the attribute
+// are left unchanged.
+func UpdateCiphertext(MPK *MPK, CT *ABECiphertext, uk *UpdateKey) error {
+	c2 := CT.C2[uk.Attr]
+	if c2 == nil {
+		return nil
+	}
+	if CT.Versions[uk.Attr]+1 != uk.Version {
+		return fmt.Errorf("attribute %s of the ciphertext is at version %d, update key is for version %d", uk.Attr, CT.Versions[uk.Attr], uk.Version)
+	}
+	inv := new(big.Int).ModInverse(uk.Factor, MPK.Order)
+	if inv == nil {
+		return fmt.Errorf("invalid update key")
+	}
+	if CT.Versions == nil {
+		CT.Versions = make(map[string]uint64)
+	}
+	CT.C2[uk.Attr] = new(bn256.G2).ScalarMult(c2, inv)
+	CT.Versions[uk.Attr] = uk.Version
+	return nil
+}
@@ -0,0 +1,285 @@
+package CPABE
+
+import (
+	"fmt"
+
+	"github.com/WXY1313/Trade/Crypto/Codec"
+	"github.com/fentec-project/bn256"
+)
+
+// Marshal encodes the master public key.
+func (mpk *MPK) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABEMPK)
+	e.G1(mpk.G1)
+	e.G2(mpk.G2)
+	e.G1(mpk.U1)
+	e.G2(mpk.U2)
+	e.G1(mpk.H1)
+	e.G2(mpk.H2)
+	e.G1(mpk.AlphaG1)
+	e.G1Map(mpk.AttrPKs)
+	e.Uint64Map(mpk.Versions)
+	e.G2(mpk.KappaG2)
+	e.G1(mpk.AG1)
+	e.G2(mpk.AG2)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a master public key produced by Marshal.
+func (mpk *MPK) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABEMPK)
+	out := &MPK{
+		G1:       d.G1(),
+		G2:       d.G2(),
+		U1:       d.G1(),
+		U2:       d.G2(),
+		H1:       d.G1(),
+		H2:       d.G2(),
+		AlphaG1:  d.G1(),
+		Order:    bn256.Order,
+		AttrPKs:  d.G1Map(),
+		Versions: d.Uint64Map(),
+		KappaG2:  d.G2(),
+		AG1:      d.G1(),
+		AG2:      d.G2(),
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if len(out.AttrPKs) != len(out.Versions) {
+		return fmt.Errorf("attribute elements do not match the attribute versions")
+	}
+	for at, v := range out.Versions {
+		if v == 0 || out.AttrPKs[at] == nil {
+			return fmt.Errorf("attribute %s has no element for version %d", at, v)
+		}
+	}
+	*mpk = *out
+	return nil
+}
+
+// Marshal encodes the attribute key.
+func (sk *SK) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABESK)
+	e.G1(sk.K)
+	e.G2(sk.L)
+	e.Scalar(sk.T)
+	e.G1(sk.D)
+	e.G1Map(sk.KXs)
+	e.Uint64Map(sk.Versions)
+	return e.Bytes()
+}
+
+// Unmarshal decodes an attribute key produced by Marshal.
+func (sk *SK) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABESK)
+	out := &SK{
+		K:        d.G1(),
+		L:        d.G2(),
+		T:        d.Scalar(),
+		D:        d.G1(),
+		KXs:      d.G1Map(),
+		Versions: d.Uint64Map(),
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	for at := range out.Versions {
+		if out.KXs[at] == nil {
+			return fmt.Errorf("version for missing attribute %s", at)
+		}
+	}
+	*sk = *out
+	return nil
+}
+
+// Marshal encodes the ciphertext. Message is the encryptor's plaintext and is
+// never written.
+func (ct *ABECiphertext) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABECiphertext)
+	e.G1(ct.Com)
+	e.MSP(ct.MSP)
+	e.G1(ct.C)
+	e.G2(ct._C)
+	e.G2(ct.CA)
+	e.G1Map(ct.C1)
+	e.G2Map(ct.C2)
+	e.G1Map(ct.C3)
+	e.Uint64Map(ct.Versions)
+	e.Blob(ct.Tag)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a ciphertext produced by Marshal. The per-attribute
+// components must match the rows of the MSP exactly.
+func (ct *ABECiphertext) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABECiphertext)
+	out := &ABECiphertext{
+		Com: d.G1(),
+		MSP: d.MSP(),
+		C:   d.G1(),
+		_C:  d.G2(),
+		CA:  d.G2(),
+		C1:  d.G1Map(),
+		C2:  d.G2Map(),
+		C3:  d.G1Map(),
+	}
+	out.Versions = d.Uint64Map()
+	out.Tag = d.Blob()
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	rows := make(map[string]bool)
+	for _, at := range out.MSP.RowToAttrib {
+		if rows[at] {
+			return fmt.Errorf("attribute %s labels more than one MSP row", at)
+		}
+		rows[at] = true
+		if out.C1[at] == nil || out.C2[at] == nil || out.C3[at] == nil {
+			return fmt.Errorf("attribute %s not in ciphertext dicts", at)
+		}
+	}
+	if len(out.C1) != len(rows) || len(out.C2) != len(rows) || len(out.C3) != len(rows) {
+		return fmt.Errorf("ciphertext dicts do not match the MSP rows")
+	}
+	for at := range out.Versions {
+		if !rows[at] {
+			return fmt.Errorf("version for attribute %s not in the MSP", at)
+		}
+	}
+	*ct = *out
+	return nil
+}
+
+// Marshal encodes the partially decrypted ciphertext returned by Transform.
+func (pt *PartialCiphertext) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABEPartial)
+	e.GT(pt.T0)
+	e.GT(pt.T1)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a partially decrypted ciphertext produced by Marshal.
+func (pt *PartialCiphertext) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABEPartial)
+	out := &PartialCiphertext{
+		T0: d.GT(),
+		T1: d.GT(),
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	*pt = *out
+	return nil
+}
+
+// Marshal encodes the ciphertext. Message is never written.
+func (ct *ReuseCiphertext) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABEReuse)
+	e.G1(ct.Com)
+	e.MSP(ct.MSP)
+	e.G1(ct.C)
+	e.G2(ct._C)
+	e.G2(ct.CA)
+	e.Uint32(len(ct.C1))
+	for i := range ct.C1 {
+		e.G1(ct.C1[i])
+		e.G2(ct.C2[i])
+		e.G1(ct.C3[i])
+	}
+	e.Uint64Map(ct.Versions)
+	e.Blob(ct.Tag)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a ciphertext produced by Marshal. There must be one
+// component of each kind per MSP row.
+func (ct *ReuseCiphertext) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABEReuse)
+	out := &ReuseCiphertext{
+		Com: d.G1(),
+		MSP: d.MSP(),
+		C:   d.G1(),
+		_C:  d.G2(),
+		CA:  d.G2(),
+	}
+	for n := d.Uint32(); n > 0 && d.Err() == nil; n-- {
+		out.C1 = append(out.C1, d.G1())
+		out.C2 = append(out.C2, d.G2())
+		out.C3 = append(out.C3, d.G1())
+	}
+	out.Versions = d.Uint64Map()
+	out.Tag = d.Blob()
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if len(out.C1) != len(out.MSP.Mat) {
+		return fmt.Errorf("ciphertext has %d rows, MSP has %d", len(out.C1), len(out.MSP.Mat))
+	}
+	rows := make(map[string]bool)
+	for _, at := range out.MSP.RowToAttrib {
+		rows[at] = true
+	}
+	for at := range out.Versions {
+		if !rows[at] {
+			return fmt.Errorf("version for attribute %s not in the MSP", at)
+		}
+	}
+	*ct = *out
+	return nil
+}
+
+// Marshal encodes the policy update key for the server holding the
+// ciphertext.
+func (uk *PolicyUpdateKey) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeCPABEPolicyKey)
+	e.String(uk.Policy)
+	e.MSP(uk.MSP)
+	e.G1Map(uk.D1)
+	e.G1Map(uk.D3)
+	e.G1Map(uk.C1)
+	e.G2Map(uk.C2)
+	e.G1Map(uk.C3)
+	e.Uint64Map(uk.Versions)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a policy update key produced by Marshal. Every MSP row
+// must be either a shift or a new row.
+func (uk *PolicyUpdateKey) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeCPABEPolicyKey)
+	out := &PolicyUpdateKey{
+		Policy:   d.String(),
+		MSP:      d.MSP(),
+		D1:       d.G1Map(),
+		D3:       d.G1Map(),
+		C1:       d.G1Map(),
+		C2:       d.G2Map(),
+		C3:       d.G1Map(),
+		Versions: d.Uint64Map(),
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	rows := make(map[string]bool)
+	shifts, fresh := 0, 0
+	for _, at := range out.MSP.RowToAttrib {
+		if rows[at] {
+			return fmt.Errorf("attribute %s labels more than one MSP row", at)
+		}
+		rows[at] = true
+		switch {
+		case out.D1[at] != nil && out.D3[at] != nil:
+			shifts++
+		case out.C1[at] != nil && out.C2[at] != nil && out.C3[at] != nil:
+			fresh++
+		default:
+			return fmt.Errorf("attribute %s not in update key", at)
+		}
+	}
+	if len(out.D1) != shifts || len(out.D3) != shifts || len(out.C1) != fresh || len(out.C2) != fresh || len(out.C3) != fresh {
+		return fmt.Errorf("update key does not match the MSP rows")
+	}
+	*uk = *out
+	return nil
+}
@@ -0,0 +1,241 @@
+package CPABE
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/WXY1313/Trade/Crypto/SSS/sss"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Threshold KGC. Alpha is generated by a joint-Feldman DKG among n
+// authorities, any t of which can issue keys:
+//
+//   - every authority i deals a random si with sss.ShareFeldman, publishing
+//     the commitments of fi and sending fi(j) to authority j;
+//   - alpha = ∑si is never formed, authority j holds alphaj = ∑fi(j) and
+//     g1^{alpha} and VKj = g1^{alphaj} follow from the commitments.
+//
+// Only alpha is thresholded. The rest of the MSK (a, κ, attribute versions)
+// comes from ThresholdParams and is held in full by every authority, so a
+// single corrupt authority can still re-tag a key to T' as K^{(a+T)/(a+T')},
+// framing another identity, and compute every hidden label. The threshold
+// protects key issuing, not tracing or policy hiding.
+//
+// For a buyer with identity id every authority issues a partial key with
+// alphaj, its own tj and the tag T = H(id); the keys are linear in
+// (alphaj, tj), so the buyer combines t of them with Lagrange coefficients
+// into a key with alpha and t = ∑λj·tj. Each partial key is checked against
+// VKj first, which exposes a cheating authority.
+
+// Authority is one authority of a threshold KGC. MSK.Alpha is its share.
+type Authority struct {
+	Index int
+	MSK   *MSK
+}
+
+// Deal is the public part of one authority's DKG contribution.
+type Deal struct {
+	From    int
+	Commits []*bn256.G1 // Feldman commitments g1^{ak} of f, k = 0..t-1
+}
+
+// PartialKey is the key issued by one authority.
+type PartialKey struct {
+	Index int
+	SK
+}
+
+// DKGDeal creates the contribution of authority from. shares[j-1] must be
+// sent privately to authority j.
+func DKGDeal(from, n, t int) (*Deal, []*big.Int, error) {
+	if t < 1 || t > n || from < 1 || from > n {
+		return nil, nil, fmt.Errorf("invalid authority %d for a %d-of-%d KGC", from, t, n)
+	}
+	sampler := sample.NewUniformRange(big.NewInt(1), bn256.Order)
+	s, _ := sampler.Sample()
+	shares, commits, err := sss.ShareFeldman(s, n, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Deal{From: from, Commits: commits}, shares, nil
+}
+
+// VerifyDeal checks that deal commits to a polynomial of degree t-1.
+func VerifyDeal(deal *Deal, n, t int) error {
+	if len(deal.Commits) != t || t < 1 || t > n {
+		return fmt.Errorf("deal of authority %d has %d commitments", deal.From, len(deal.Commits))
+	}
+	for _, c := range deal.Commits {
+		if c == nil {
+			return fmt.Errorf("deal of authority %d is incomplete", deal.From)
+		}
+	}
+	return nil
+}
+
+// VerifyDealShare checks the share authority j received from deal.
+func VerifyDealShare(deal *Deal, j int, share *big.Int) bool {
+	if j < 1 {
+		return false
+	}
+	return sss.VerifyFeldman(share, j, deal.Commits)
+}
+
+// DKGFinish checks all deals, sets MPK.AlphaG1 = g1^{alpha} and returns the
+// verification keys VK[j-1] = g1^{alphaj}.
+func DKGFinish(MPK *MPK, deals []*Deal, n, t int) ([]*bn256.G1, error) {
+	if len(deals) != n {
+		return nil, fmt.Errorf("got %d deals for %d authorities", len(deals), n)
+	}
+	seen := make(map[int]bool)
+	alphaG1 := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	VKs := make([]*bn256.G1, n)
+	for j := range VKs {
+		VKs[j] = new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	}
+	for _, deal := range deals {
+		if seen[deal.From] {
+			return nil, fmt.Errorf("two deals from authority %d", deal.From)
+		}
+		seen[deal.From] = true
+		if err := VerifyDeal(deal, n, t); err != nil {
+			return nil, err
+		}
+		alphaG1.Add(alphaG1, deal.Commits[0])
+		for j := range VKs {
+			vk, err := sss.CommitmentAt(deal.Commits, big.NewInt(int64(j+1)))
+			if err != nil {
+				return nil, err
+			}
+			VKs[j].Add(VKs[j], vk)
+		}
+	}
+	MPK.AlphaG1 = alphaG1
+	return VKs, nil
+}
+
+// DKGShare sums the shares authority j received, shares[i] coming from
+// deals[i], into its share of alpha.
+func DKGShare(deals []*Deal, j int, shares []*big.Int) (*big.Int, error) {
+	if len(shares) != len(deals) {
+		return nil, fmt.Errorf("got %d shares for %d deals", len(shares), len(deals))
+	}
+	alpha := big.NewInt(0)
+	for i, deal := range deals {
+		if !VerifyDealShare(deal, j, shares[i]) {
+			return nil, fmt.Errorf("share from authority %d is invalid", deal.From)
+		}
+		alpha.Add(alpha, shares[i])
+	}
+	return alpha.Mod(alpha, bn256.Order), nil
+}
+
+// ThresholdParams generates the public parameters and the common part of
+// the MSK of a threshold KGC. Alpha is left out: MPK.AlphaG1 is set by
+// DKGFinish and every authority gets its share from DKGShare.
+func ThresholdParams() (*MPK, *MSK, error) {
+	mpk, msk, err := Setup()
+	if err != nil {
+		return nil, nil, err
+	}
+	mpk.AlphaG1 = nil
+	msk.Alpha = nil
+	return mpk, msk, nil
+}
+
+// NewAuthority returns authority j of a threshold KGC with the common MSK and
+// its share alpha from DKGShare.
+func NewAuthority(j int, common *MSK, alpha *big.Int) *Authority {
+	versions := make(map[string]*big.Int)
+	for at, v := range common.Versions {
+		versions[at] = v
+	}
+	return &Authority{Index: j, MSK: &MSK{
+		Alpha:      alpha,
+		Versions:   versions,
+		Kappa:      common.Kappa,
+		A:          common.A,
+		Identities: make(map[string]string),
+	}}
+}
+
+// IdentityTag is the tracing tag T = H(id) of keys issued by a threshold KGC.
+func IdentityTag(id string) *big.Int {
+	h := sha256.Sum256([]byte("CPABE:tag:" + id))
+	return new(big.Int).Mod(new(big.Int).SetBytes(h[:]), bn256.Order)
+}
+
+// PartialKeyGen issues AU's partial key for su to identity id.
+func PartialKeyGen(MPK *MPK, AU *Authority, id string, su []string) (*PartialKey, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty identity")
+	}
+	T := IdentityTag(id)
+	SK, err := keyGen(MPK, AU.MSK, T, su)
+	if err != nil {
+		return nil, err
+	}
+	AU.MSK.Identities[T.String()] = id
+	return &PartialKey{Index: AU.Index, SK: *SK}, nil
+}
+
+// CombineKeys checks the partial keys against the verification keys and
+// combines t of them into the key of identity id.
+func CombineKeys(MPK *MPK, VKs []*bn256.G1, id string, partials []*PartialKey, t int) (*SK, error) {
+	T := IdentityTag(id)
+	seen := make(map[int]bool)
+	for _, pk := range partials {
+		if pk.Index < 1 || pk.Index > len(VKs) || seen[pk.Index] {
+			return nil, fmt.Errorf("invalid authority index %d", pk.Index)
+		}
+		seen[pk.Index] = true
+		if pk.T == nil || pk.T.Cmp(T) != 0 || !wellFormed(MPK, VKs[pk.Index-1], &pk.SK) {
+			return nil, fmt.Errorf("partial key of authority %d is invalid", pk.Index)
+		}
+	}
+	if len(partials) < t {
+		return nil, fmt.Errorf("not enough partial keys: got %d, need %d", len(partials), t)
+	}
+	used := make([]*PartialKey, t)
+	copy(used, partials)
+	sort.Slice(used, func(i, j int) bool { return used[i].Index < used[j].Index })
+	I := make([]*big.Int, t)
+	for k, pk := range used {
+		I[k] = big.NewInt(int64(pk.Index))
+	}
+	lambdas, err := sss.PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, err
+	}
+
+	sk := &SK{
+		K:        new(bn256.G1).ScalarBaseMult(big.NewInt(0)),
+		L:        new(bn256.G2).ScalarBaseMult(big.NewInt(0)),
+		T:        T,
+		D:        used[0].D,
+		KXs:      make(map[string]*bn256.G1),
+		Versions: make(map[string]uint64),
+	}
+	for at, v := range used[0].Versions {
+		sk.KXs[at] = new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+		sk.Versions[at] = v
+	}
+	for k, pk := range used {
+		if len(pk.KXs) != len(sk.KXs) {
+			return nil, fmt.Errorf("partial key of authority %d has other attributes", pk.Index)
+		}
+		sk.K.Add(sk.K, new(bn256.G1).ScalarMult(pk.K, lambdas[k]))
+		sk.L.Add(sk.L, new(bn256.G2).ScalarMult(pk.L, lambdas[k]))
+		for at, kx := range pk.KXs {
+			if sk.KXs[at] == nil || pk.Versions[at] != sk.Versions[at] {
+				return nil, fmt.Errorf("partial key of authority %d has other attributes", pk.Index)
+			}
+			sk.KXs[at].Add(sk.KXs[at], new(bn256.G1).ScalarMult(kx, lambdas[k]))
+		}
+	}
+	return sk, nil
+}
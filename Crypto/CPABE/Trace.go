@@ -0,0 +1,86 @@
+package CPABE
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// Traceable keys in the style of Ning, Cao, Dong and Wei. Every key carries a
+// tag T and K = (u1^alpha*h1^t)^{1/(a+T)}, which only combines with
+// CA*_C^T = g2^{(a+T)beta}. A key keeps decrypting only as long as T is left
+// untouched, so a leaked key reveals its tag, and KeyGenID records the
+// identity behind each tag.
+//
+// TraceBlackBox traces a decoder it can only query. For every recorded tag c
+// it builds a probe with _C = g2^{beta+δ} and CA = g2^{a*beta-cδ}: a key
+// with tag T sees g2^{(a+T)beta+(T-c)δ}, so only the key tagged c decrypts
+// it correctly. Probes fail CipherCheck, so a decoder that checks its input
+// can refuse them; the harness catches decoders built on Decrypt.
+
+// Decoder is a decryption oracle, e.g. a pirate box wrapping a leaked key.
+type Decoder func(CT *ABECiphertext) (*bn256.GT, error)
+
+// KeyGenID issues a key for su to identity id and records its tag.
+func KeyGenID(MPK *MPK, MSK *MSK, id string, su []string) (*SK, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty identity")
+	}
+	SK, err := KeyGen(MPK, MSK, su)
+	if err != nil {
+		return nil, err
+	}
+	MSK.Identities[SK.T.String()] = id
+	return SK, nil
+}
+
+// Trace returns the identity a leaked key was issued to. The key must be
+// usable for decryption; its delegation part D is not needed.
+func Trace(MPK *MPK, MSK *MSK, SK *SK) (string, error) {
+	if !traceable(MPK, MPK.AlphaG1, SK) {
+		return "", fmt.Errorf("the key is not well formed")
+	}
+	id, ok := MSK.Identities[SK.T.String()]
+	if !ok {
+		return "", fmt.Errorf("no identity recorded for the key")
+	}
+	return id, nil
+}
+
+// TraceBlackBox queries D with one probe under policy per recorded identity
+// and returns the identity whose key D holds. policy must be satisfied by the
+// attributes of that key.
+func TraceBlackBox(MPK *MPK, MSK *MSK, policy string, D Decoder) (string, error) {
+	tags := make([]string, 0, len(MSK.Identities))
+	for tag := range MSK.Identities {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	sampler := sample.NewUniformRange(big.NewInt(1), MPK.Order)
+	for _, tag := range tags {
+		c, ok := new(big.Int).SetString(tag, 10)
+		if !ok {
+			return "", fmt.Errorf("invalid tag %s in the identity table", tag)
+		}
+		m, _ := sampler.Sample()
+		probe, err := Encrypt(MPK, m, policy)
+		if err != nil {
+			return "", err
+		}
+		//_C=g2^{beta+δ}, CA=g2^{a*beta-cδ}
+		delta, _ := sampler.Sample()
+		probe._C.Add(probe._C, new(bn256.G2).ScalarMult(MPK.G2, delta))
+		cDelta := new(big.Int).Mul(c, delta)
+		cDelta.Neg(cDelta).Mod(cDelta, MPK.Order)
+		probe.CA.Add(probe.CA, new(bn256.G2).ScalarMult(MPK.G2, cDelta))
+		M, err := D(probe)
+		if err == nil && M != nil && Operation.GTEqual(M, probe.Message) {
+			return MSK.Identities[tag], nil
+		}
+	}
+	return "", fmt.Errorf("the decoder matches no recorded identity")
+}
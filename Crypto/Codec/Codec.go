@@ -0,0 +1,608 @@
+// Binary encoding shared by the keys and ciphertexts of CPABE, Sub and DT.
+//
+// Every encoded object starts with a two byte header (format version, object
+// type). Group elements of G1 and G2 are point-compressed, GT elements use the
+// canonical bn256 marshalling, scalars are fixed 32-byte big-endian values and
+// variable length data is prefixed with a 4-byte big-endian length. Decoding is
+// strict: unknown versions or types, points that are not on the curve (or not in
+// the prime order subgroup), non-canonical field elements, scalars outside Zp
+// and trailing bytes are all rejected.
+package Codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+)
+
+// Version is the current encoding format version.
+const Version byte = 1
+
+// Object type identifiers carried in the header.
+const (
+	TypeCPABEMPK        byte = 0x01
+	TypeCPABESK         byte = 0x02
+	TypeCPABECiphertext byte = 0x03
+	TypeCPABEPartial    byte = 0x04
+	TypeCPABEReuse      byte = 0x05
+	TypeCPABEPolicyKey  byte = 0x06
+	TypeSubSPK          byte = 0x11
+	TypeSubKey          byte = 0x12
+	TypeSubCiphertext   byte = 0x13
+	TypeDTCiphertext    byte = 0x21
+	TypeDTReKey         byte = 0x22
+)
+
+const (
+	fieldBytes = 32
+	// G1Size and G2Size are the lengths of compressed points.
+	G1Size = 1 + fieldBytes
+	G2Size = 1 + 2*fieldBytes
+	// GTSize is the length of a marshalled GT element.
+	GTSize = 12 * fieldBytes
+
+	// maxLen bounds every length prefix so corrupted input cannot trigger
+	// huge allocations.
+	maxLen = 1 << 26
+	// maxDepth bounds the nesting of decoded access trees.
+	maxDepth = 64
+)
+
+// Encoder accumulates the encoding of one object. The first error is kept and
+// returned by Bytes.
+type Encoder struct {
+	buf bytes.Buffer
+	err error
+}
+
+// NewEncoder starts an encoding of an object of the given type.
+func NewEncoder(typ byte) *Encoder {
+	e := &Encoder{}
+	e.buf.WriteByte(Version)
+	e.buf.WriteByte(typ)
+	return e
+}
+
+func (e *Encoder) fail(format string, a ...interface{}) {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, a...)
+	}
+}
+
+// Bytes returns the encoding or the first error hit while encoding.
+func (e *Encoder) Bytes() ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// Uint32 writes n as 4 big-endian bytes.
+func (e *Encoder) Uint32(n int) {
+	if n < 0 || n > maxLen {
+		e.fail("codec: length %d out of range", n)
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	e.buf.Write(b[:])
+}
+
+// Uint64 writes n as 8 big-endian bytes.
+func (e *Encoder) Uint64(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf.Write(b[:])
+}
+
+// Bool writes b as a single byte.
+func (e *Encoder) Bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+// Blob writes a length-prefixed byte string.
+func (e *Encoder) Blob(b []byte) {
+	e.Uint32(len(b))
+	e.buf.Write(b)
+}
+
+// String writes a length-prefixed string.
+func (e *Encoder) String(s string) {
+	e.Blob([]byte(s))
+}
+
+// Scalar writes x mod Order as 32 bytes.
+func (e *Encoder) Scalar(x *big.Int) {
+	if x == nil {
+		e.fail("codec: nil scalar")
+		return
+	}
+	var b [fieldBytes]byte
+	new(big.Int).Mod(x, bn256.Order).FillBytes(b[:])
+	e.buf.Write(b[:])
+}
+
+// Int writes an arbitrary signed integer (used for MSP matrix entries).
+func (e *Encoder) Int(x *big.Int) {
+	if x == nil {
+		e.fail("codec: nil integer")
+		return
+	}
+	e.Bool(x.Sign() < 0)
+	e.Blob(new(big.Int).Abs(x).Bytes())
+}
+
+// G1 writes a compressed G1 element.
+func (e *Encoder) G1(p *bn256.G1) {
+	if p == nil {
+		e.fail("codec: nil G1 element")
+		return
+	}
+	e.buf.Write(CompressG1(p))
+}
+
+// G2 writes a compressed G2 element.
+func (e *Encoder) G2(p *bn256.G2) {
+	if p == nil {
+		e.fail("codec: nil G2 element")
+		return
+	}
+	e.buf.Write(CompressG2(p))
+}
+
+// GT writes a GT element.
+func (e *Encoder) GT(p *bn256.GT) {
+	if p == nil {
+		e.fail("codec: nil GT element")
+		return
+	}
+	e.buf.Write(p.Marshal())
+}
+
+// G1Map writes a map of G1 elements sorted by key.
+func (e *Encoder) G1Map(m map[string]*bn256.G1) {
+	keys := sortedKeys(m)
+	e.Uint32(len(keys))
+	for _, k := range keys {
+		e.String(k)
+		e.G1(m[k])
+	}
+}
+
+// G2Map writes a map of G2 elements sorted by key.
+func (e *Encoder) G2Map(m map[string]*bn256.G2) {
+	keys := sortedKeys(m)
+	e.Uint32(len(keys))
+	for _, k := range keys {
+		e.String(k)
+		e.G2(m[k])
+	}
+}
+
+// Uint64Map writes a map of counters sorted by key.
+func (e *Encoder) Uint64Map(m map[string]uint64) {
+	keys := sortedKeys(m)
+	e.Uint32(len(keys))
+	for _, k := range keys {
+		e.String(k)
+		e.Uint64(m[k])
+	}
+}
+
+// MSP writes the explicit MSP matrix together with its row labels.
+func (e *Encoder) MSP(msp *abe.MSP) {
+	if msp == nil {
+		e.fail("codec: nil MSP")
+		return
+	}
+	rows := len(msp.Mat)
+	if rows != len(msp.RowToAttrib) {
+		e.fail("codec: MSP has %d rows but %d labels", rows, len(msp.RowToAttrib))
+		return
+	}
+	cols := 0
+	if rows > 0 {
+		cols = len(msp.Mat[0])
+	}
+	//An unset modulus (as left by abe.BooleanToMSP) is written as 0
+	if msp.P != nil {
+		e.Int(msp.P)
+	} else {
+		e.Int(big.NewInt(0))
+	}
+	e.Uint32(rows)
+	e.Uint32(cols)
+	for i := 0; i < rows; i++ {
+		if len(msp.Mat[i]) != cols {
+			e.fail("codec: MSP row %d has %d columns, want %d", i, len(msp.Mat[i]), cols)
+			return
+		}
+		e.String(msp.RowToAttrib[i])
+		for j := 0; j < cols; j++ {
+			e.Int(msp.Mat[i][j])
+		}
+	}
+}
+
+// Tree writes an LSSS access tree in pre-order: leaves as their label, gates
+// as T, the number of children and the children.
+func (e *Encoder) Tree(root *LSSS.Node) {
+	if err := LSSS.CheckTree(root); err != nil {
+		e.fail("codec: %v", err)
+		return
+	}
+	var write func(n *LSSS.Node)
+	write = func(n *LSSS.Node) {
+		e.Bool(n.IsLeaf)
+		if n.Idx != nil {
+			e.Int(n.Idx)
+		} else {
+			e.Int(big.NewInt(0))
+		}
+		if n.IsLeaf {
+			e.String(n.Label)
+			return
+		}
+		e.Uint32(n.T)
+		e.Uint32(len(n.Children))
+		for _, child := range n.Children {
+			write(child)
+		}
+	}
+	write(root)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Decoder reads one object. The first error is kept; once an error occurred
+// all further reads return zero values.
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+// NewDecoder checks the header of data against the expected object type.
+func NewDecoder(data []byte, typ byte) *Decoder {
+	d := &Decoder{buf: data}
+	if len(data) < 2 {
+		d.err = errors.New("codec: missing header")
+		return d
+	}
+	if data[0] != Version {
+		d.err = fmt.Errorf("codec: unsupported version %d", data[0])
+		return d
+	}
+	if data[1] != typ {
+		d.err = fmt.Errorf("codec: object type 0x%02x, want 0x%02x", data[1], typ)
+		return d
+	}
+	d.buf = data[2:]
+	return d
+}
+
+func (d *Decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.fail("codec: unexpected end of data")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// Err returns the first decoding error.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish reports the first decoding error, or an error if unread bytes remain.
+func (d *Decoder) Finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("codec: %d trailing bytes", len(d.buf))
+	}
+	return nil
+}
+
+// Uint32 reads a 4-byte length or count.
+func (d *Decoder) Uint32() int {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > maxLen {
+		d.fail("codec: length %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+// Uint64 reads 8 big-endian bytes.
+func (d *Decoder) Uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// Bool reads a single byte that must be 0 or 1.
+func (d *Decoder) Bool() bool {
+	b := d.next(1)
+	if b == nil {
+		return false
+	}
+	if b[0] > 1 {
+		d.fail("codec: invalid boolean 0x%02x", b[0])
+		return false
+	}
+	return b[0] == 1
+}
+
+// Blob reads a length-prefixed byte string.
+func (d *Decoder) Blob() []byte {
+	n := d.Uint32()
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// String reads a length-prefixed string.
+func (d *Decoder) String() string {
+	return string(d.Blob())
+}
+
+// Scalar reads a 32-byte scalar that must be smaller than Order.
+func (d *Decoder) Scalar() *big.Int {
+	b := d.next(fieldBytes)
+	if b == nil {
+		return nil
+	}
+	x := new(big.Int).SetBytes(b)
+	if x.Cmp(bn256.Order) >= 0 {
+		d.fail("codec: scalar out of range")
+		return nil
+	}
+	return x
+}
+
+// Int reads a signed integer written by Encoder.Int.
+func (d *Decoder) Int() *big.Int {
+	neg := d.Bool()
+	b := d.Blob()
+	if d.err != nil {
+		return nil
+	}
+	if len(b) > 0 && b[0] == 0 {
+		d.fail("codec: non-canonical integer")
+		return nil
+	}
+	x := new(big.Int).SetBytes(b)
+	if neg {
+		if x.Sign() == 0 {
+			d.fail("codec: non-canonical integer")
+			return nil
+		}
+		x.Neg(x)
+	}
+	return x
+}
+
+// G1 reads a compressed G1 element.
+func (d *Decoder) G1() *bn256.G1 {
+	b := d.next(G1Size)
+	if b == nil {
+		return nil
+	}
+	p, err := DecompressG1(b)
+	if err != nil {
+		d.fail("%v", err)
+		return nil
+	}
+	return p
+}
+
+// G2 reads a compressed G2 element.
+func (d *Decoder) G2() *bn256.G2 {
+	b := d.next(G2Size)
+	if b == nil {
+		return nil
+	}
+	p, err := DecompressG2(b)
+	if err != nil {
+		d.fail("%v", err)
+		return nil
+	}
+	return p
+}
+
+// GT reads a GT element.
+func (d *Decoder) GT() *bn256.GT {
+	b := d.next(GTSize)
+	if b == nil {
+		return nil
+	}
+	for i := 0; i < 12; i++ {
+		if new(big.Int).SetBytes(b[i*fieldBytes:(i+1)*fieldBytes]).Cmp(fieldP) >= 0 {
+			d.fail("codec: GT coordinate out of range")
+			return nil
+		}
+	}
+	p := new(bn256.GT)
+	if _, err := p.Unmarshal(b); err != nil {
+		d.fail("codec: %v", err)
+		return nil
+	}
+	return p
+}
+
+// G1Map reads a map written by Encoder.G1Map. Keys must be strictly increasing.
+func (d *Decoder) G1Map() map[string]*bn256.G1 {
+	n := d.Uint32()
+	m := make(map[string]*bn256.G1)
+	prev := ""
+	for i := 0; i < n && d.err == nil; i++ {
+		k := d.String()
+		if i > 0 && k <= prev {
+			d.fail("codec: map keys not sorted or duplicated")
+			return nil
+		}
+		prev = k
+		m[k] = d.G1()
+	}
+	if d.err != nil {
+		return nil
+	}
+	return m
+}
+
+// G2Map reads a map written by Encoder.G2Map. Keys must be strictly increasing.
+func (d *Decoder) G2Map() map[string]*bn256.G2 {
+	n := d.Uint32()
+	m := make(map[string]*bn256.G2)
+	prev := ""
+	for i := 0; i < n && d.err == nil; i++ {
+		k := d.String()
+		if i > 0 && k <= prev {
+			d.fail("codec: map keys not sorted or duplicated")
+			return nil
+		}
+		prev = k
+		m[k] = d.G2()
+	}
+	if d.err != nil {
+		return nil
+	}
+	return m
+}
+
+// Uint64Map reads a map written by Encoder.Uint64Map. Keys must be strictly
+// increasing.
+func (d *Decoder) Uint64Map() map[string]uint64 {
+	n := d.Uint32()
+	m := make(map[string]uint64)
+	prev := ""
+	for i := 0; i < n && d.err == nil; i++ {
+		k := d.String()
+		if i > 0 && k <= prev {
+			d.fail("codec: map keys not sorted or duplicated")
+			return nil
+		}
+		prev = k
+		m[k] = d.Uint64()
+	}
+	if d.err != nil {
+		return nil
+	}
+	return m
+}
+
+// MSP reads an MSP written by Encoder.MSP.
+func (d *Decoder) MSP() *abe.MSP {
+	p := d.Int()
+	if p != nil && p.Sign() == 0 {
+		p = nil
+	}
+	rows := d.Uint32()
+	cols := d.Uint32()
+	if d.err != nil {
+		return nil
+	}
+	if rows == 0 || cols == 0 {
+		d.fail("codec: empty MSP matrix")
+		return nil
+	}
+	if rows*cols > maxLen/fieldBytes {
+		d.fail("codec: MSP matrix too large")
+		return nil
+	}
+	mat := make(data.Matrix, rows)
+	labels := make([]string, rows)
+	for i := 0; i < rows && d.err == nil; i++ {
+		labels[i] = d.String()
+		mat[i] = make(data.Vector, cols)
+		for j := 0; j < cols; j++ {
+			mat[i][j] = d.Int()
+		}
+	}
+	if d.err != nil {
+		return nil
+	}
+	return &abe.MSP{P: p, Mat: mat, RowToAttrib: labels}
+}
+
+// Tree reads an access tree written by Encoder.Tree and rejects trees that
+// fail LSSS.CheckTree or nest deeper than maxDepth.
+func (d *Decoder) Tree() *LSSS.Node {
+	var read func(depth int) *LSSS.Node
+	read = func(depth int) *LSSS.Node {
+		if depth > maxDepth {
+			d.fail("codec: access tree too deep")
+			return nil
+		}
+		isLeaf := d.Bool()
+		idx := d.Int()
+		if d.err != nil {
+			return nil
+		}
+		if isLeaf {
+			return LSSS.NewLeaf(d.String(), idx)
+		}
+		t := d.Uint32()
+		n := d.Uint32()
+		if d.err != nil {
+			return nil
+		}
+		if n > len(d.buf) {
+			d.fail("codec: access tree gate too large")
+			return nil
+		}
+		node := LSSS.NewNode(false, n, t, idx)
+		for i := 0; i < n && d.err == nil; i++ {
+			node.Children = append(node.Children, read(depth+1))
+		}
+		return node
+	}
+	root := read(0)
+	if d.err != nil {
+		return nil
+	}
+	if err := LSSS.CheckTree(root); err != nil {
+		d.fail("codec: %v", err)
+		return nil
+	}
+	return root
+}
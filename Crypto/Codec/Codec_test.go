@@ -0,0 +1,104 @@
+package Codec
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		_, p1, _ := bn256.RandomG1(rand.Reader)
+		q1, err := DecompressG1(CompressG1(p1))
+		require.NoError(t, err)
+		require.Equal(t, p1.Marshal(), q1.Marshal())
+
+		_, p2, _ := bn256.RandomG2(rand.Reader)
+		q2, err := DecompressG2(CompressG2(p2))
+		require.NoError(t, err)
+		require.Equal(t, p2.Marshal(), q2.Marshal())
+	}
+	zero1 := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	q1, err := DecompressG1(CompressG1(zero1))
+	require.NoError(t, err)
+	require.Equal(t, zero1.Marshal(), q1.Marshal())
+	zero2 := new(bn256.G2).ScalarBaseMult(big.NewInt(0))
+	q2, err := DecompressG2(CompressG2(zero2))
+	require.NoError(t, err)
+	require.Equal(t, zero2.Marshal(), q2.Marshal())
+
+	//x^3+3 is not a square for x=2
+	bad := make([]byte, G1Size)
+	bad[0], bad[G1Size-1] = 0x02, 2
+	_, err = DecompressG1(bad)
+	require.Error(t, err)
+	//x coordinates must be reduced
+	bad = make([]byte, G1Size)
+	bad[0] = 0x02
+	fieldP.FillBytes(bad[1:])
+	_, err = DecompressG1(bad)
+	require.Error(t, err)
+	//Most x in GF(p²) give points on the twist outside G2 or off the curve
+	rejected := 0
+	for i := byte(1); i <= 8; i++ {
+		bad = make([]byte, G2Size)
+		bad[0], bad[G2Size-1] = 0x02, i
+		if _, err := DecompressG2(bad); err != nil {
+			rejected++
+		}
+	}
+	require.Equal(t, 8, rejected)
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	msp, err := abe.BooleanToMSP("(a AND b) OR c", false)
+	require.NoError(t, err)
+	_, g1, _ := bn256.RandomG1(rand.Reader)
+	_, g2, _ := bn256.RandomG2(rand.Reader)
+	_, gt, _ := bn256.RandomGT(rand.Reader)
+	x, _ := rand.Int(rand.Reader, bn256.Order)
+
+	e := NewEncoder(TypeCPABECiphertext)
+	e.String("policy")
+	e.Scalar(x)
+	e.G1(g1)
+	e.G2(g2)
+	e.GT(gt)
+	e.MSP(msp)
+	e.G1Map(map[string]*bn256.G1{"b": g1, "a": g1})
+	enc, err := e.Bytes()
+	require.NoError(t, err)
+
+	d := NewDecoder(enc, TypeCPABECiphertext)
+	require.Equal(t, "policy", d.String())
+	require.Equal(t, 0, x.Cmp(d.Scalar()))
+	require.Equal(t, g1.Marshal(), d.G1().Marshal())
+	require.Equal(t, g2.Marshal(), d.G2().Marshal())
+	require.Equal(t, gt.Marshal(), d.GT().Marshal())
+	msp2 := d.MSP()
+	require.Equal(t, msp.RowToAttrib, msp2.RowToAttrib)
+	for i := range msp.Mat {
+		for j := range msp.Mat[i] {
+			require.Equal(t, 0, msp.Mat[i][j].Cmp(msp2.Mat[i][j]))
+		}
+	}
+	require.Len(t, d.G1Map(), 2)
+	require.NoError(t, d.Finish())
+
+	//Wrong type, wrong version, truncation and trailing bytes are rejected
+	require.Error(t, NewDecoder(enc, TypeCPABESK).Finish())
+	enc2 := append([]byte{}, enc...)
+	enc2[0] = Version + 1
+	require.Error(t, NewDecoder(enc2, TypeCPABECiphertext).Finish())
+	d = NewDecoder(enc[:len(enc)-1], TypeCPABECiphertext)
+	_ = d.String()
+	_ = d.Scalar()
+	require.Error(t, d.Finish())
+	d = NewDecoder(append(append([]byte{}, enc[:2]...), 0, 0, 0, 0, 7), TypeCPABECiphertext)
+	_ = d.String()
+	require.Error(t, d.Finish())
+}
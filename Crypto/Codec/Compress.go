@@ -0,0 +1,232 @@
+package Codec
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/fentec-project/bn256"
+)
+
+// fieldP is the characteristic of the base field of bn256.
+var fieldP, _ = new(big.Int).SetString("65000549695646603732796438742359905742825358107623003571877145026864184071783", 10)
+
+// sqrtExp is (p+1)/4; p ≡ 3 (mod 4) so x^sqrtExp is a square root of a square x.
+var sqrtExp = new(big.Int).Rsh(new(big.Int).Add(fieldP, big.NewInt(1)), 2)
+
+var half = new(big.Int).ModInverse(big.NewInt(2), fieldP)
+
+// fp2 is the element Re + Im*i of GF(p²) with i² = -1, matching bn256.
+type fp2 struct {
+	Re, Im *big.Int
+}
+
+// twistB is the constant b' of the twist y² = x³ + b'. It is recovered from
+// the G2 generator so it always matches the linked bn256 implementation.
+var twistB = func() fp2 {
+	x, y := g2Coords(new(bn256.G2).ScalarBaseMult(big.NewInt(1)).Marshal())
+	return fp2Sub(fp2Mul(y, y), fp2Mul(fp2Mul(x, x), x))
+}()
+
+func g2Coords(m []byte) (fp2, fp2) {
+	coord := func(k int) *big.Int {
+		return new(big.Int).SetBytes(m[1+k*fieldBytes : 1+(k+1)*fieldBytes])
+	}
+	return fp2{Re: coord(1), Im: coord(0)}, fp2{Re: coord(3), Im: coord(2)}
+}
+
+func fpSqrt(a *big.Int) (*big.Int, bool) {
+	r := new(big.Int).Exp(a, sqrtExp, fieldP)
+	if new(big.Int).Mod(new(big.Int).Mul(r, r), fieldP).Cmp(new(big.Int).Mod(a, fieldP)) != 0 {
+		return nil, false
+	}
+	return r, true
+}
+
+func fpMod(x *big.Int) *big.Int {
+	return x.Mod(x, fieldP)
+}
+
+func fp2Mul(a, b fp2) fp2 {
+	re := new(big.Int).Sub(new(big.Int).Mul(a.Re, b.Re), new(big.Int).Mul(a.Im, b.Im))
+	im := new(big.Int).Add(new(big.Int).Mul(a.Re, b.Im), new(big.Int).Mul(a.Im, b.Re))
+	return fp2{Re: fpMod(re), Im: fpMod(im)}
+}
+
+func fp2Add(a, b fp2) fp2 {
+	return fp2{Re: fpMod(new(big.Int).Add(a.Re, b.Re)), Im: fpMod(new(big.Int).Add(a.Im, b.Im))}
+}
+
+func fp2Sub(a, b fp2) fp2 {
+	return fp2{Re: fpMod(new(big.Int).Sub(a.Re, b.Re)), Im: fpMod(new(big.Int).Sub(a.Im, b.Im))}
+}
+
+func fp2Neg(a fp2) fp2 {
+	return fp2{Re: fpMod(new(big.Int).Neg(a.Re)), Im: fpMod(new(big.Int).Neg(a.Im))}
+}
+
+func fp2Equal(a, b fp2) bool {
+	return a.Re.Cmp(b.Re) == 0 && a.Im.Cmp(b.Im) == 0
+}
+
+// fp2Sqrt uses the norm method: for a = a0 + a1*i, x0² = (a0 ± sqrt(a0² + a1²))/2
+// and x1 = a1/(2*x0).
+func fp2Sqrt(a fp2) (fp2, bool) {
+	zero := big.NewInt(0)
+	if a.Im.Sign() == 0 {
+		if r, ok := fpSqrt(a.Re); ok {
+			return fp2{Re: r, Im: zero}, true
+		}
+		// -1 is a non-residue, so -a0 is a square and sqrt(a0) = i*sqrt(-a0)
+		r, ok := fpSqrt(fpMod(new(big.Int).Neg(a.Re)))
+		return fp2{Re: zero, Im: r}, ok
+	}
+	norm := fpMod(new(big.Int).Add(new(big.Int).Mul(a.Re, a.Re), new(big.Int).Mul(a.Im, a.Im)))
+	s, ok := fpSqrt(norm)
+	if !ok {
+		return fp2{}, false
+	}
+	t := fpMod(new(big.Int).Mul(new(big.Int).Add(a.Re, s), half))
+	x0, ok := fpSqrt(t)
+	if !ok {
+		t = fpMod(new(big.Int).Mul(new(big.Int).Sub(a.Re, s), half))
+		if x0, ok = fpSqrt(t); !ok {
+			return fp2{}, false
+		}
+	}
+	inv := new(big.Int).ModInverse(fpMod(new(big.Int).Lsh(x0, 1)), fieldP)
+	x := fp2{Re: x0, Im: fpMod(new(big.Int).Mul(a.Im, inv))}
+	if !fp2Equal(fp2Mul(x, x), a) {
+		return fp2{}, false
+	}
+	return x, true
+}
+
+// fp2Odd is the sign used for G2 compression: the parity of the real part, or
+// of the imaginary part when the real part is zero.
+func fp2Odd(a fp2) bool {
+	if a.Re.Sign() != 0 {
+		return a.Re.Bit(0) == 1
+	}
+	return a.Im.Bit(0) == 1
+}
+
+// CompressG1 encodes p as a prefix byte (0x00 infinity, 0x02 even y, 0x03 odd
+// y) followed by the 32-byte x coordinate.
+func CompressG1(p *bn256.G1) []byte {
+	m := p.Marshal()
+	out := make([]byte, G1Size)
+	y := new(big.Int).SetBytes(m[fieldBytes:])
+	x := m[:fieldBytes]
+	if new(big.Int).SetBytes(x).Sign() == 0 && y.Sign() == 0 {
+		return out
+	}
+	out[0] = 0x02 | byte(y.Bit(0))
+	copy(out[1:], x)
+	return out
+}
+
+// DecompressG1 decodes the output of CompressG1, rejecting x coordinates that
+// are not canonical or do not lie on the curve.
+func DecompressG1(b []byte) (*bn256.G1, error) {
+	if len(b) != G1Size {
+		return nil, errors.New("codec: wrong G1 encoding length")
+	}
+	x := new(big.Int).SetBytes(b[1:])
+	switch b[0] {
+	case 0x00:
+		if x.Sign() != 0 {
+			return nil, errors.New("codec: malformed G1 infinity")
+		}
+		return new(bn256.G1).ScalarBaseMult(big.NewInt(0)), nil
+	case 0x02, 0x03:
+	default:
+		return nil, errors.New("codec: malformed G1 prefix")
+	}
+	if x.Cmp(fieldP) >= 0 {
+		return nil, errors.New("codec: G1 coordinate out of range")
+	}
+	rhs := fpMod(new(big.Int).Add(new(big.Int).Exp(x, big.NewInt(3), fieldP), big.NewInt(3)))
+	y, ok := fpSqrt(rhs)
+	if !ok {
+		return nil, errors.New("codec: G1 point not on curve")
+	}
+	if y.Sign() == 0 && b[0] == 0x03 {
+		return nil, errors.New("codec: malformed G1 prefix")
+	}
+	if uint(y.Bit(0)) != uint(b[0]&1) {
+		y.Sub(fieldP, y)
+	}
+	m := make([]byte, 2*fieldBytes)
+	x.FillBytes(m[:fieldBytes])
+	y.FillBytes(m[fieldBytes:])
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(m); err != nil {
+		return nil, err
+	}
+	// G1 has cofactor 1, so every point on the curve is in the group
+	return p, nil
+}
+
+// CompressG2 encodes p as a prefix byte (0x00 infinity, 0x02/0x03 for the
+// sign of y, see fp2Odd) followed by x = x.Im || x.Re.
+func CompressG2(p *bn256.G2) []byte {
+	m := p.Marshal()
+	out := make([]byte, G2Size)
+	if len(m) == 1 {
+		return out
+	}
+	_, y := g2Coords(m)
+	out[0] = 0x02
+	if fp2Odd(y) {
+		out[0] = 0x03
+	}
+	copy(out[1:], m[1:1+2*fieldBytes])
+	return out
+}
+
+// DecompressG2 decodes the output of CompressG2, rejecting points that are not
+// on the twist or not in the order-n subgroup G2.
+func DecompressG2(b []byte) (*bn256.G2, error) {
+	if len(b) != G2Size {
+		return nil, errors.New("codec: wrong G2 encoding length")
+	}
+	x := fp2{Im: new(big.Int).SetBytes(b[1 : 1+fieldBytes]), Re: new(big.Int).SetBytes(b[1+fieldBytes:])}
+	switch b[0] {
+	case 0x00:
+		if x.Re.Sign() != 0 || x.Im.Sign() != 0 {
+			return nil, errors.New("codec: malformed G2 infinity")
+		}
+		return new(bn256.G2).ScalarBaseMult(big.NewInt(0)), nil
+	case 0x02, 0x03:
+	default:
+		return nil, errors.New("codec: malformed G2 prefix")
+	}
+	if x.Re.Cmp(fieldP) >= 0 || x.Im.Cmp(fieldP) >= 0 {
+		return nil, errors.New("codec: G2 coordinate out of range")
+	}
+	y, ok := fp2Sqrt(fp2Add(fp2Mul(fp2Mul(x, x), x), twistB))
+	if !ok {
+		return nil, errors.New("codec: G2 point not on curve")
+	}
+	if y.Re.Sign() == 0 && y.Im.Sign() == 0 && b[0] == 0x03 {
+		return nil, errors.New("codec: malformed G2 prefix")
+	}
+	if fp2Odd(y) != (b[0] == 0x03) {
+		y = fp2Neg(y)
+	}
+	m := make([]byte, 1+4*fieldBytes)
+	m[0] = 0x01
+	x.Im.FillBytes(m[1 : 1+fieldBytes])
+	x.Re.FillBytes(m[1+fieldBytes : 1+2*fieldBytes])
+	y.Im.FillBytes(m[1+2*fieldBytes : 1+3*fieldBytes])
+	y.Re.FillBytes(m[1+3*fieldBytes:])
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(m); err != nil {
+		return nil, err
+	}
+	// The twist has a large cofactor, so check membership in the subgroup
+	if len(new(bn256.G2).ScalarMult(p, bn256.Order).Marshal()) != 1 {
+		return nil, errors.New("codec: G2 point not in subgroup")
+	}
+	return p, nil
+}
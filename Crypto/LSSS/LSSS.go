@@ -4,8 +4,11 @@ import (
 	"crypto/rand"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
 )
 
 type Node struct {
@@ -14,6 +17,7 @@ type Node struct {
 	Childrennum int
 	T           int
 	Idx         *big.Int
+	Label       string // names the party holding a leaf's share
 }
 
 //Threshold Type
@@ -27,6 +31,213 @@ func NewNode(IsLeaf bool, num int, T int, idx *big.Int) *Node {
 	}
 }
 
+// NewLeaf returns a leaf whose share is held by the party named label.
+func NewLeaf(label string, idx *big.Int) *Node {
+	leaf := NewNode(true, 0, 1, idx)
+	leaf.Label = label
+	return leaf
+}
+
+// Leaves returns the leaves of root in the order of the rows of Convert(root).
+func Leaves(root *Node) []*Node {
+	if root.IsLeaf {
+		return []*Node{root}
+	}
+	var leaves []*Node
+	for _, child := range root.Children {
+		leaves = append(leaves, Leaves(child)...)
+	}
+	return leaves
+}
+
+// CheckTree checks that every inner node is a T-of-n gate with 1 <= T <= n
+// and that the leaves carry distinct, non-empty labels.
+func CheckTree(root *Node) error {
+	if root == nil {
+		return fmt.Errorf("empty access tree")
+	}
+	labels := make(map[string]bool)
+	var check func(n *Node) error
+	check = func(n *Node) error {
+		if n.IsLeaf {
+			if n.Label == "" {
+				return fmt.Errorf("access tree leaf without label")
+			}
+			if labels[n.Label] {
+				return fmt.Errorf("label %s on more than one leaf", n.Label)
+			}
+			labels[n.Label] = true
+			return nil
+		}
+		if n.Childrennum != len(n.Children) || n.T < 1 || n.T > len(n.Children) {
+			return fmt.Errorf("invalid %d-of-%d gate", n.T, len(n.Children))
+		}
+		for _, child := range n.Children {
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(root)
+}
+
+// AuthorizedRows picks rows of Convert(root) that are held by parties in
+// labels and satisfy the tree, preferring the children that need the fewest
+// rows at every gate. It fails if labels do not satisfy the tree.
+func AuthorizedRows(root *Node, labels map[string]bool) ([]int, error) {
+	return CheapestRows(root, labels, nil)
+}
+
+// CheapestRows is AuthorizedRows with a cost per leaf: at every gate it
+// takes the T children whose own choice costs least, which gives the
+// cheapest authorized set of the tree. A nil cost counts every leaf as 1.
+func CheapestRows(root *Node, labels map[string]bool, cost func(label string) int) ([]int, error) {
+	if cost == nil {
+		cost = func(string) int { return 1 }
+	}
+	next := 0
+	rows, _, ok := authorizedRows(root, labels, cost, &next)
+	if !ok {
+		return nil, fmt.Errorf("labels do not satisfy the access tree")
+	}
+	sort.Ints(rows)
+	return rows, nil
+}
+
+func authorizedRows(n *Node, labels map[string]bool, cost func(string) int, next *int) ([]int, int, bool) {
+	if n.IsLeaf {
+		row := *next
+		*next++
+		if labels[n.Label] {
+			return []int{row}, cost(n.Label), true
+		}
+		return nil, 0, false
+	}
+	// Every child is visited so that the row counter stays in step
+	type choice struct {
+		rows []int
+		cost int
+	}
+	var choices []choice
+	for _, child := range n.Children {
+		if rows, c, ok := authorizedRows(child, labels, cost, next); ok {
+			choices = append(choices, choice{rows, c})
+		}
+	}
+	if len(choices) < n.T {
+		return nil, 0, false
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].cost < choices[j].cost })
+	var rows []int
+	total := 0
+	for _, c := range choices[:n.T] {
+		rows = append(rows, c.rows...)
+		total += c.cost
+	}
+	return rows, total, true
+}
+
+// ReconCoeffs returns w with sum_k w[k]*matrix[rows[k]] = (1,0,...,0) mod p, so
+// that s = sum_k w[k]*λ_rows[k]. It works for any authorized set of rows,
+// not only those giving a square submatrix.
+func ReconCoeffs(matrix [][]*big.Int, rows []int, p *big.Int) ([]*big.Int, error) {
+	if len(matrix) == 0 || len(matrix[0]) == 0 || len(rows) == 0 {
+		return nil, fmt.Errorf("empty reconstruction set")
+	}
+	mat := make(data.Matrix, len(rows))
+	for k, i := range rows {
+		if i < 0 || i >= len(matrix) {
+			return nil, fmt.Errorf("row %d out of range", i)
+		}
+		mat[k] = make(data.Vector, len(matrix[i]))
+		for j, x := range matrix[i] {
+			mat[k][j] = new(big.Int).Mod(x, p)
+		}
+	}
+	one := data.NewConstantVector(len(matrix[0]), big.NewInt(0))
+	one[0] = big.NewInt(1)
+	w, err := data.GaussianEliminationSolver(mat.Transpose(), one, p)
+	if err != nil {
+		return nil, fmt.Errorf("rows are not authorized: %v", err)
+	}
+	return w, nil
+}
+
+// TreeRecon reconstructs s from shares λ keyed by the labels of the leaves
+// of root, over the cheapest authorized set of them.
+func TreeRecon(root *Node, shares map[string]*big.Int, cost func(label string) int) (*big.Int, error) {
+	have := make(map[string]bool, len(shares))
+	for label, share := range shares {
+		have[label] = share != nil
+	}
+	labels, w, err := treeCoeffs(root, have, cost)
+	if err != nil {
+		return nil, err
+	}
+	s := big.NewInt(0)
+	for k, label := range labels {
+		s.Add(s, new(big.Int).Mul(w[k], shares[label]))
+	}
+	return s.Mod(s, bn256.Order), nil
+}
+
+// TreeReconG1 is TreeRecon for shares g^λ.
+func TreeReconG1(root *Node, shares map[string]*bn256.G1, cost func(label string) int) (*bn256.G1, error) {
+	have := make(map[string]bool, len(shares))
+	for label, share := range shares {
+		have[label] = share != nil
+	}
+	labels, w, err := treeCoeffs(root, have, cost)
+	if err != nil {
+		return nil, err
+	}
+	s := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for k, label := range labels {
+		s.Add(s, new(bn256.G1).ScalarMult(shares[label], w[k]))
+	}
+	return s, nil
+}
+
+// TreeReconGT is TreeRecon for shares e^λ.
+func TreeReconGT(root *Node, shares map[string]*bn256.GT, cost func(label string) int) (*bn256.GT, error) {
+	have := make(map[string]bool, len(shares))
+	for label, share := range shares {
+		have[label] = share != nil
+	}
+	labels, w, err := treeCoeffs(root, have, cost)
+	if err != nil {
+		return nil, err
+	}
+	s := new(bn256.GT).ScalarBaseMult(big.NewInt(0))
+	for k, label := range labels {
+		s.Add(s, new(bn256.GT).ScalarMult(shares[label], w[k]))
+	}
+	return s, nil
+}
+
+// treeCoeffs returns the labels of the cheapest authorized set of root among
+// labels and their reconstruction coefficients.
+func treeCoeffs(root *Node, labels map[string]bool, cost func(string) int) ([]string, []*big.Int, error) {
+	if err := CheckTree(root); err != nil {
+		return nil, nil, err
+	}
+	rows, err := CheapestRows(root, labels, cost)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := ReconCoeffs(Convert(root), rows, bn256.Order)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaves := Leaves(root)
+	chosen := make([]string, len(rows))
+	for k, i := range rows {
+		chosen[k] = leaves[i].Label
+	}
+	return chosen, w, nil
+}
+
 func GrpLSSSShare(S *bn256.G1, AA *Node) ([]*bn256.G1, error) {
 	matrix := Convert(AA)
 	if len(matrix) == 0 || len(matrix[0]) == 0 {
@@ -99,9 +310,15 @@ func GrpLSSSReconGT(invRecMatrix [][]*big.Int, shares []*bn256.GT, I []int) (*bn
 }
 
 func LSSSShare(s *big.Int, matrix [][]*big.Int) ([]*big.Int, error) {
+	shares, _, err := lsssShare(s, matrix)
+	return shares, err
+}
+
+// lsssShare shares s like LSSSShare and also returns the vector v.
+func lsssShare(s *big.Int, matrix [][]*big.Int) ([]*big.Int, []*big.Int, error) {
 	// matrix := Convert(AA)
 	if len(matrix) == 0 || len(matrix[0]) == 0 {
-		return nil, fmt.Errorf("Matrix is empty")
+		return nil, nil, fmt.Errorf("Matrix is empty")
 	}
 	matrixRows := len(matrix)
 	matrixCols := len(matrix[0])
@@ -121,7 +338,7 @@ func LSSSShare(s *big.Int, matrix [][]*big.Int) ([]*big.Int, error) {
 	for i, lambda := range lambdas {
 		shares[i] = lambda[0]
 	}
-	return shares, nil
+	return shares, v, nil
 }
 
 func LSSSRecon(invRecMatrix [][]*big.Int, shares []*big.Int, I []int) (*big.Int, error) {
@@ -492,3 +709,56 @@ func GenerateParityMatrix(M [][]*big.Int, P *big.Int) [][]*big.Int {
 	}
 	return H
 }
+
+// Share splits s over the rows of msp: λi = Mi·v mod p with v[0] = s and the
+// remaining entries of v random. The map is keyed by row index.
+func Share(msp *abe.MSP, s *big.Int, p *big.Int) (map[int]*big.Int, error) {
+	if len(msp.Mat) == 0 || len(msp.Mat[0]) == 0 {
+		return nil, fmt.Errorf("empty msp matrix")
+	}
+	v := make(data.Vector, msp.Mat.Cols())
+	v[0] = new(big.Int).Mod(s, p)
+	for i := 1; i < len(v); i++ {
+		v[i], _ = rand.Int(rand.Reader, p)
+	}
+	lambdas := make(map[int]*big.Int, msp.Mat.Rows())
+	for i, row := range msp.Mat {
+		lambda, err := row.Dot(v)
+		if err != nil {
+			return nil, err
+		}
+		lambdas[i] = lambda.Mod(lambda, p)
+	}
+	return lambdas, nil
+}
+
+// ReconGT recovers e^s from shares e^{λi} held for a subset of the rows of msp.
+// It fails if the rows present in shares are not authorized.
+func ReconGT(msp *abe.MSP, shares map[int]*bn256.GT, p *big.Int) (*bn256.GT, error) {
+	rows := make([]int, 0, len(shares))
+	for i := range shares {
+		if i < 0 || i >= len(msp.Mat) {
+			return nil, fmt.Errorf("share index %d out of range", i)
+		}
+		rows = append(rows, i)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no shares")
+	}
+	sort.Ints(rows)
+	mat := make(data.Matrix, len(rows))
+	for k, i := range rows {
+		mat[k] = msp.Mat[i]
+	}
+	one := data.NewConstantVector(msp.Mat.Cols(), big.NewInt(0))
+	one[0] = big.NewInt(1)
+	c, err := data.GaussianEliminationSolver(mat.Transpose(), one, p)
+	if err != nil {
+		return nil, fmt.Errorf("shares are not authorized: %v", err)
+	}
+	recon := new(bn256.GT).ScalarBaseMult(big.NewInt(0))
+	for k, i := range rows {
+		recon.Add(recon, new(bn256.GT).ScalarMult(shares[i], c[k]))
+	}
+	return recon, nil
+}
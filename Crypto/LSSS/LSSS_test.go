@@ -1,11 +1,15 @@
 package LSSS
 
 import (
+	"crypto/rand"
 	"fmt"
 	"math/big"
 	"testing"
 
+	"github.com/WXY1313/Trade/Crypto/Operation"
 	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLSSS(t *testing.T) {
@@ -35,3 +39,212 @@ func TestLSSS(t *testing.T) {
 	fmt.Printf("matrix * verMatrix = %v\n", verResult[0])
 	fmt.Printf("BN256 Order = %v\n", bn256.Order)
 }
+
+func TestShareReconGT(t *testing.T) {
+	//(A AND B) OR C
+	msp, err := abe.BooleanToMSP("(A AND B) OR C", false)
+	if err != nil {
+		t.Fatalf("BooleanToMSP failed: %v", err)
+	}
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	lambdas, err := Share(msp, s, bn256.Order)
+	if err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+	if len(lambdas) != len(msp.Mat) {
+		t.Fatalf("got %d shares for %d rows", len(lambdas), len(msp.Mat))
+	}
+	want := new(bn256.GT).ScalarBaseMult(s)
+	shares := func(attribs ...string) map[int]*bn256.GT {
+		out := make(map[int]*bn256.GT)
+		for i, at := range msp.RowToAttrib {
+			for _, a := range attribs {
+				if at == a {
+					out[i] = new(bn256.GT).ScalarBaseMult(lambdas[i])
+				}
+			}
+		}
+		return out
+	}
+	for _, attribs := range [][]string{{"A", "B"}, {"C"}, {"A", "B", "C"}} {
+		recon, err := ReconGT(msp, shares(attribs...), bn256.Order)
+		if err != nil {
+			t.Fatalf("ReconGT failed for %v: %v", attribs, err)
+		}
+		if recon.String() != want.String() {
+			t.Fatalf("ReconGT gave a wrong secret for %v", attribs)
+		}
+	}
+	if _, err := ReconGT(msp, shares("A"), bn256.Order); err == nil {
+		t.Fatal("ReconGT accepted an unauthorized set")
+	}
+	if _, err := ReconGT(msp, map[int]*bn256.GT{len(msp.Mat): want}, bn256.Order); err == nil {
+		t.Fatal("ReconGT accepted a share of a missing row")
+	}
+}
+
+func TestAuthorizedRows(t *testing.T) {
+	//2-of-(A,1-of-(B,C),2-of-(D,E,F))
+	root := NewNode(false, 3, 2, big.NewInt(0))
+	P_1 := NewNode(false, 2, 1, big.NewInt(2))
+	P_2 := NewNode(false, 3, 2, big.NewInt(3))
+	root.Children = []*Node{NewLeaf("A", big.NewInt(1)), P_1, P_2}
+	P_1.Children = []*Node{NewLeaf("B", big.NewInt(1)), NewLeaf("C", big.NewInt(2))}
+	P_2.Children = []*Node{NewLeaf("D", big.NewInt(1)), NewLeaf("E", big.NewInt(2)), NewLeaf("F", big.NewInt(3))}
+	require.NoError(t, CheckTree(root))
+
+	matrix := Convert(root)
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	shares, _ := LSSSShare(s, matrix)
+	for _, labels := range [][]string{{"A", "C"}, {"B", "E", "F"}, {"A", "B", "C", "D", "E", "F"}} {
+		have := make(map[string]bool)
+		for _, label := range labels {
+			have[label] = true
+		}
+		I, err := AuthorizedRows(root, have)
+		require.NoError(t, err)
+		w, err := ReconCoeffs(matrix, I, bn256.Order)
+		require.NoError(t, err)
+		recon := big.NewInt(0)
+		for k, i := range I {
+			recon.Add(recon, new(big.Int).Mul(w[k], shares[i]))
+		}
+		require.Equal(t, 0, new(big.Int).Mod(s, bn256.Order).Cmp(recon.Mod(recon, bn256.Order)))
+	}
+	//Fewest rows are picked: A and C rather than the 2-of-3 branch
+	I, _ := AuthorizedRows(root, map[string]bool{"A": true, "C": true, "D": true, "E": true})
+	require.Equal(t, []int{0, 2}, I)
+
+	_, err := AuthorizedRows(root, map[string]bool{"A": true, "D": true})
+	require.Error(t, err)
+	_, err = ReconCoeffs(matrix, []int{0, 3}, bn256.Order)
+	require.Error(t, err)
+
+	P_2.Children[2].Label = "A"
+	require.Error(t, CheckTree(root))
+}
+
+func TestRefresh(t *testing.T) {
+	//2-of-(A,B,C)
+	root := NewNode(false, 3, 2, big.NewInt(0))
+	root.Children = []*Node{NewLeaf("A", big.NewInt(1)), NewLeaf("B", big.NewInt(2)), NewLeaf("C", big.NewInt(3))}
+	matrix := Convert(root)
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	shares, commits, err := ShareFeldman(s, matrix)
+	require.NoError(t, err)
+	for i := range shares {
+		require.True(t, VerifyFeldman(matrix, i, shares[i], commits))
+	}
+	recon := func(matrix [][]*big.Int, rows []int, shares []*big.Int) *big.Int {
+		w, err := ReconCoeffs(matrix, rows, bn256.Order)
+		require.NoError(t, err)
+		sum := big.NewInt(0)
+		for k, i := range rows {
+			sum.Add(sum, new(big.Int).Mul(w[k], shares[i]))
+		}
+		return sum.Mod(sum, bn256.Order)
+	}
+
+	//Refresh with two zero sharings
+	var zeroShares [][]*big.Int
+	var zeroCommits [][]*bn256.G1
+	for k := 0; k < 2; k++ {
+		zs, zc, err := ZeroShare(matrix)
+		require.NoError(t, err)
+		zeroShares = append(zeroShares, zs)
+		zeroCommits = append(zeroCommits, zc)
+	}
+	refreshed := make([]*big.Int, len(shares))
+	for i := range refreshed {
+		refreshed[i], err = Refresh(matrix, i, shares[i], []*big.Int{zeroShares[0][i], zeroShares[1][i]}, zeroCommits)
+		require.NoError(t, err)
+	}
+	newCommits, err := RefreshCommits(commits, zeroCommits)
+	require.NoError(t, err)
+	for i := range refreshed {
+		require.True(t, VerifyFeldman(matrix, i, refreshed[i], newCommits))
+	}
+	require.Equal(t, 0, s.Cmp(recon(matrix, []int{0, 2}, refreshed)))
+	require.NotEqual(t, 0, s.Cmp(recon(matrix, []int{0, 2}, []*big.Int{shares[0], nil, refreshed[2]})))
+	badShares, badCommits, _ := ShareFeldman(big.NewInt(1), matrix)
+	_, err = Refresh(matrix, 0, shares[0], []*big.Int{badShares[0]}, [][]*bn256.G1{badCommits})
+	require.Error(t, err)
+
+	//A and C reshare to 2-of-(D,1-of-(E,F))
+	newRoot := NewNode(false, 2, 2, big.NewInt(0))
+	P_1 := NewNode(false, 2, 1, big.NewInt(2))
+	newRoot.Children = []*Node{NewLeaf("D", big.NewInt(1)), P_1}
+	P_1.Children = []*Node{NewLeaf("E", big.NewInt(1)), NewLeaf("F", big.NewInt(2))}
+	newMatrix := Convert(newRoot)
+	rows := []int{0, 2}
+	subShares := make([][]*big.Int, len(rows))
+	subCommits := make([][]*bn256.G1, len(rows))
+	for k, i := range rows {
+		subShares[k], subCommits[k], err = ShareFeldman(refreshed[i], newMatrix)
+		require.NoError(t, err)
+		require.True(t, VerifyReshare(matrix, newCommits, i, newMatrix, subCommits[k]))
+	}
+	require.False(t, VerifyReshare(matrix, newCommits, 1, newMatrix, subCommits[0]))
+	reshared := make([]*big.Int, len(newMatrix))
+	for j := range reshared {
+		reshared[j], err = CombineReshares(matrix, rows, newMatrix, j, []*big.Int{subShares[0][j], subShares[1][j]}, subCommits)
+		require.NoError(t, err)
+	}
+	resharedCommits, err := ReshareCommits(matrix, rows, subCommits)
+	require.NoError(t, err)
+	require.True(t, VerifyFeldman(newMatrix, 2, reshared[2], resharedCommits))
+	require.Equal(t, 0, s.Cmp(recon(newMatrix, []int{0, 2}, reshared)))
+	_, err = CombineReshares(matrix, rows, newMatrix, 1, []*big.Int{subShares[0][0], subShares[1][1]}, subCommits)
+	require.Error(t, err)
+}
+
+func TestTreeRecon(t *testing.T) {
+	//2-of-(A,1-of-(B,C),2-of-(D,E,F))
+	root := NewNode(false, 3, 2, big.NewInt(0))
+	P_1 := NewNode(false, 2, 1, big.NewInt(2))
+	P_2 := NewNode(false, 3, 2, big.NewInt(3))
+	root.Children = []*Node{NewLeaf("A", big.NewInt(1)), P_1, P_2}
+	P_1.Children = []*Node{NewLeaf("B", big.NewInt(1)), NewLeaf("C", big.NewInt(2))}
+	P_2.Children = []*Node{NewLeaf("D", big.NewInt(1)), NewLeaf("E", big.NewInt(2)), NewLeaf("F", big.NewInt(3))}
+
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	lambdas, err := LSSSShare(s, Convert(root))
+	require.NoError(t, err)
+	shares := make(map[string]*big.Int)
+	sharesG1 := make(map[string]*bn256.G1)
+	sharesGT := make(map[string]*bn256.GT)
+	for i, leaf := range Leaves(root) {
+		shares[leaf.Label] = lambdas[i]
+		sharesG1[leaf.Label] = new(bn256.G1).ScalarBaseMult(lambdas[i])
+		sharesGT[leaf.Label] = new(bn256.GT).ScalarBaseMult(lambdas[i])
+	}
+	recon, err := TreeRecon(root, shares, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, s.Cmp(recon))
+	reconG1, err := TreeReconG1(root, sharesG1, nil)
+	require.NoError(t, err)
+	require.True(t, Operation.G1Equal(reconG1, new(bn256.G1).ScalarBaseMult(s)))
+	reconGT, err := TreeReconGT(root, sharesGT, nil)
+	require.NoError(t, err)
+	require.True(t, Operation.GTEqual(reconGT, new(bn256.GT).ScalarBaseMult(s)))
+
+	//A costs more than D and E together, so (B, D, E) is chosen over (A, B)
+	cost := func(label string) int {
+		if label == "A" {
+			return 5
+		}
+		return 1
+	}
+	I, err := CheapestRows(root, map[string]bool{"A": true, "B": true, "D": true, "E": true}, cost)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3, 4}, I)
+	I, err = CheapestRows(root, map[string]bool{"A": true, "B": true, "D": true, "E": true}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1}, I)
+
+	delete(shares, "A")
+	delete(shares, "B")
+	delete(shares, "C")
+	_, err = TreeRecon(root, shares, nil)
+	require.Error(t, err)
+}
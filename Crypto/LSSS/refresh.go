@@ -0,0 +1,158 @@
+package LSSS
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/WXY1313/Trade/Crypto/SSS/sss"
+	"github.com/fentec-project/bn256"
+)
+
+// Verifiable LSSS sharings and their proactive refresh and resharing, as in
+// sss for Shamir sharings. For λ = M·v the dealer publishes Ck = g1^{vk},
+// and row i checks g1^{λi} = ∏Ck^{Mik}.
+//
+// Refresh: every dealer shares 0 over the same matrix with ZeroShare and the
+// holder of row i adds the zero shares to λi; shares from before and after a
+// refresh do not combine.
+//
+// Resharing to a new access tree: the holders of an authorized set of rows
+// each share their λi over the new matrix, the dealing being tied to the old
+// sharing by VerifyReshare. The new shares are combined with the
+// reconstruction coefficients of the old rows.
+
+// ShareFeldman shares s like LSSSShare and returns the commitments g1^{vk}.
+func ShareFeldman(s *big.Int, matrix [][]*big.Int) ([]*big.Int, []*bn256.G1, error) {
+	shares, v, err := lsssShare(new(big.Int).Mod(s, bn256.Order), matrix)
+	if err != nil {
+		return nil, nil, err
+	}
+	commits := make([]*bn256.G1, len(v))
+	for k, vk := range v {
+		commits[k] = new(bn256.G1).ScalarBaseMult(vk)
+	}
+	return shares, commits, nil
+}
+
+// RowCommitment returns g1^{λi} for row i from the commitments.
+func RowCommitment(matrix [][]*big.Int, i int, commits []*bn256.G1) (*bn256.G1, error) {
+	if i < 0 || i >= len(matrix) {
+		return nil, fmt.Errorf("row %d out of range", i)
+	}
+	if len(commits) != len(matrix[i]) {
+		return nil, fmt.Errorf("got %d commitments for %d columns", len(commits), len(matrix[i]))
+	}
+	sum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for k, c := range commits {
+		if c == nil {
+			return nil, fmt.Errorf("commitment %d is missing", k)
+		}
+		sum.Add(sum, new(bn256.G1).ScalarMult(c, new(big.Int).Mod(matrix[i][k], bn256.Order)))
+	}
+	return sum, nil
+}
+
+// VerifyFeldman checks the share of row i against commits.
+func VerifyFeldman(matrix [][]*big.Int, i int, share *big.Int, commits []*bn256.G1) bool {
+	expected, err := RowCommitment(matrix, i, commits)
+	if err != nil || share == nil {
+		return false
+	}
+	return Operation.G1Equal(new(bn256.G1).ScalarBaseMult(new(big.Int).Mod(share, bn256.Order)), expected)
+}
+
+// ZeroShare deals a sharing of 0 over matrix for a refresh.
+func ZeroShare(matrix [][]*big.Int) ([]*big.Int, []*bn256.G1, error) {
+	return ShareFeldman(big.NewInt(0), matrix)
+}
+
+// VerifyZeroShare checks the zero share of row i against commits, which must
+// be a sharing of 0.
+func VerifyZeroShare(matrix [][]*big.Int, i int, share *big.Int, commits []*bn256.G1) bool {
+	if len(commits) == 0 || !Operation.G1Equal(commits[0], new(bn256.G1).ScalarBaseMult(big.NewInt(0))) {
+		return false
+	}
+	return VerifyFeldman(matrix, i, share, commits)
+}
+
+// Refresh adds the zero shares of row i, zeroShares[k] coming with
+// zeroCommits[k], to its share.
+func Refresh(matrix [][]*big.Int, i int, share *big.Int, zeroShares []*big.Int, zeroCommits [][]*bn256.G1) (*big.Int, error) {
+	if len(zeroShares) != len(zeroCommits) {
+		return nil, fmt.Errorf("got %d zero shares for %d dealings", len(zeroShares), len(zeroCommits))
+	}
+	refreshed := new(big.Int).Set(share)
+	for k, zeroShare := range zeroShares {
+		if !VerifyZeroShare(matrix, i, zeroShare, zeroCommits[k]) {
+			return nil, fmt.Errorf("zero share %d is invalid", k)
+		}
+		refreshed.Add(refreshed, zeroShare)
+	}
+	return refreshed.Mod(refreshed, bn256.Order), nil
+}
+
+// RefreshCommits returns the commitments of the refreshed sharing, as
+// sss.RefreshCommits.
+func RefreshCommits(commits []*bn256.G1, zeroCommits [][]*bn256.G1) ([]*bn256.G1, error) {
+	return sss.RefreshCommits(commits, zeroCommits)
+}
+
+// VerifyReshare checks that commits, dealt over a new matrix by the holder
+// of old row from, reshare the share committed to in oldCommits.
+func VerifyReshare(oldMatrix [][]*big.Int, oldCommits []*bn256.G1, from int, newMatrix [][]*big.Int, commits []*bn256.G1) bool {
+	if len(newMatrix) == 0 || len(commits) != len(newMatrix[0]) {
+		return false
+	}
+	expected, err := RowCommitment(oldMatrix, from, oldCommits)
+	if err != nil {
+		return false
+	}
+	return Operation.G1Equal(commits[0], expected)
+}
+
+// CombineReshares computes the share of row j of newMatrix from the
+// sub-shares dealt by the holders of the old rows, subShares[k] and
+// commits[k] coming from row rows[k] of oldMatrix.
+func CombineReshares(oldMatrix [][]*big.Int, rows []int, newMatrix [][]*big.Int, j int, subShares []*big.Int, commits [][]*bn256.G1) (*big.Int, error) {
+	if len(subShares) != len(rows) || len(commits) != len(rows) {
+		return nil, fmt.Errorf("got %d sub-shares and %d dealings for %d rows", len(subShares), len(commits), len(rows))
+	}
+	w, err := ReconCoeffs(oldMatrix, rows, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	share := big.NewInt(0)
+	for k, subShare := range subShares {
+		if !VerifyFeldman(newMatrix, j, subShare, commits[k]) {
+			return nil, fmt.Errorf("sub-share of row %d is invalid", rows[k])
+		}
+		share.Add(share, new(big.Int).Mul(w[k], subShare))
+	}
+	return share.Mod(share, bn256.Order), nil
+}
+
+// ReshareCommits returns the commitments of the new sharing from the
+// dealings of the old rows.
+func ReshareCommits(oldMatrix [][]*big.Int, rows []int, commits [][]*bn256.G1) ([]*bn256.G1, error) {
+	if len(commits) != len(rows) || len(commits) == 0 {
+		return nil, fmt.Errorf("got %d dealings for %d rows", len(commits), len(rows))
+	}
+	w, err := ReconCoeffs(oldMatrix, rows, bn256.Order)
+	if err != nil {
+		return nil, err
+	}
+	reshared := make([]*bn256.G1, len(commits[0]))
+	for k := range reshared {
+		reshared[k] = new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	}
+	for m, cs := range commits {
+		if len(cs) != len(reshared) {
+			return nil, fmt.Errorf("dealing of row %d has %d commitments, want %d", rows[m], len(cs), len(reshared))
+		}
+		for k, c := range cs {
+			reshared[k].Add(reshared[k], new(bn256.G1).ScalarMult(c, w[m]))
+		}
+	}
+	return reshared, nil
+}
@@ -26,6 +26,7 @@ type PvGSS struct {
 	G1 *bn256.G1
 	G2 *bn256.G2
 	Gt *bn256.GT
+	H  *bn256.G1 // base of the holder keys and the secret, see PvGSS.go
 }
 
 // NewGSS configures a new instance of the scheme.
@@ -38,11 +39,17 @@ func NewGSS(order *big.Int) *GSS {
 func NewPvGSS() *PvGSS {
 	gen1 := new(bn256.G1).ScalarBaseMult(big.NewInt(1))
 	gen2 := new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+	//H is hashed, so its discrete log to G1 is unknown
+	h, err := bn256.HashG1("PvGSS:h")
+	if err != nil {
+		panic(err)
+	}
 	return &PvGSS{
 		P:  bn256.Order,
 		G1: gen1,
 		G2: gen2,
 		Gt: bn256.Pair(gen1, gen2),
+		H:  h,
 	}
 }
 
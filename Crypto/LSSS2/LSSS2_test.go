@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/WXY1313/Trade/Crypto/Policy"
 	"github.com/fentec-project/bn256"
 	bn128 "github.com/fentec-project/bn256"
 	lib "github.com/fentec-project/gofe/abe"
@@ -99,3 +100,138 @@ func TestGSS(t *testing.T) {
 	}
 	assert.Error(t, err)
 }
+
+func TestPvGSS(t *testing.T) {
+	pvgss := NewPvGSS()
+	msp, err := lib.BooleanToMSP("((holder1 AND holder2) OR (holder3 AND holder4)) OR holder5", false)
+	if err != nil {
+		t.Fatalf("Failed to generate the policy: %v\n", err)
+	}
+	sks := make(map[string]*big.Int)
+	pks := make(map[string]*bn256.G1)
+	for _, id := range msp.RowToAttrib {
+		sks[id], pks[id] = pvgss.KeyGen()
+	}
+	s, _ := sample.NewUniform(pvgss.P).Sample()
+	secret := new(bn256.G1).ScalarMult(pvgss.H, s)
+
+	d, err := pvgss.Share(s, msp, pks)
+	assert.NoError(t, err)
+	assert.True(t, pvgss.Verify(d, pks))
+
+	//holder3 and holder4 open the escrow before a public arbiter
+	var decShares []*DecShare
+	for _, id := range []string{"holder3", "holder4"} {
+		ds, err := pvgss.DecryptShare(d, id, sks[id])
+		assert.NoError(t, err)
+		assert.Len(t, ds, 1)
+		assert.True(t, pvgss.VerifyDecShare(d, pks[id], ds[0]))
+		decShares = append(decShares, ds...)
+	}
+	recon, err := pvgss.Recon(d, pks, decShares)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Marshal(), recon.Marshal())
+
+	//A wrong decrypted share is caught
+	bad := *decShares[0]
+	bad.S = new(bn256.G1).Add(bad.S, pvgss.H)
+	assert.False(t, pvgss.VerifyDecShare(d, pks["holder3"], &bad))
+	_, err = pvgss.Recon(d, pks, []*DecShare{&bad, decShares[1]})
+	assert.Error(t, err)
+	_, err = pvgss.Recon(d, pks, decShares[:1])
+	assert.Error(t, err)
+
+	//So are shares that are not a sharing of the committed secret
+	forged := *d
+	forged.Com = new(bn256.G1).Add(d.Com, pvgss.G1)
+	assert.False(t, pvgss.Verify(&forged, pks))
+	forged = *d
+	forged.Shares = append([]*PvShare{}, d.Shares...)
+	forged.Shares[4] = &PvShare{ID: "holder5", V: d.Shares[0].V, C: new(bn256.G1).ScalarMult(pks["holder5"], big.NewInt(1))}
+	assert.False(t, pvgss.Verify(&forged, pks))
+
+	//A malformed distribution is rejected without a panic
+	short := *d.MSP
+	short.RowToAttrib = d.MSP.RowToAttrib[:len(d.MSP.RowToAttrib)-1]
+	forged = *d
+	forged.MSP = &short
+	assert.False(t, pvgss.Verify(&forged, pks))
+	_, err = pvgss.Recon(&forged, pks, decShares)
+	assert.Error(t, err)
+	ragged := *d.MSP
+	ragged.Mat = append(lib.MSP{}.Mat, d.MSP.Mat...)
+	ragged.Mat[2] = ragged.Mat[2][:len(ragged.Mat[2])-1]
+	forged.MSP = &ragged
+	assert.False(t, pvgss.Verify(&forged, pks))
+	forged = *d
+	forged.Shares = d.Shares[:len(d.Shares)-1]
+	assert.False(t, pvgss.Verify(&forged, pks))
+}
+
+func TestPvGSSRepeatedHolder(t *testing.T) {
+	pvgss := NewPvGSS()
+	//holder1 owns two rows, as in an MSP from Policy.Compile
+	msp, err := Policy.Compile("(holder1 AND holder2) OR (holder1 AND holder3)")
+	if err != nil {
+		t.Fatalf("Failed to generate the policy: %v\n", err)
+	}
+	sks := make(map[string]*big.Int)
+	pks := make(map[string]*bn256.G1)
+	for _, id := range msp.RowToAttrib {
+		if sks[id] == nil {
+			sks[id], pks[id] = pvgss.KeyGen()
+		}
+	}
+	s, _ := sample.NewUniform(pvgss.P).Sample()
+	secret := new(bn256.G1).ScalarMult(pvgss.H, s)
+	d, err := pvgss.Share(s, msp, pks)
+	assert.NoError(t, err)
+	assert.True(t, pvgss.Verify(d, pks))
+
+	var decShares []*DecShare
+	for _, id := range []string{"holder1", "holder3"} {
+		ds, err := pvgss.DecryptShare(d, id, sks[id])
+		assert.NoError(t, err)
+		for _, share := range ds {
+			assert.True(t, pvgss.VerifyDecShare(d, pks[id], share))
+		}
+		decShares = append(decShares, ds...)
+	}
+	assert.Len(t, decShares, 3)
+	assert.NotEqual(t, decShares[0].S.Marshal(), decShares[1].S.Marshal())
+	recon, err := pvgss.Recon(d, pks, decShares)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Marshal(), recon.Marshal())
+
+	//A share moved to another row of its holder is caught
+	moved := *decShares[0]
+	moved.Row = decShares[1].Row
+	assert.False(t, pvgss.VerifyDecShare(d, pks["holder1"], &moved))
+}
+
+func TestPvGSSDualCode(t *testing.T) {
+	pvgss := NewPvGSS()
+	msp, err := lib.BooleanToMSP("holder1 AND (holder2 OR holder3)", false)
+	if err != nil {
+		t.Fatalf("Failed to generate the policy: %v\n", err)
+	}
+	pks := make(map[string]*bn256.G1)
+	for _, id := range msp.RowToAttrib {
+		_, pks[id] = pvgss.KeyGen()
+	}
+	//A dealer encrypting random values proves them correctly but fails the
+	//dual code check
+	d := &PvDistribution{MSP: msp, Com: pvgss.G1}
+	lambdas := make([]*big.Int, len(msp.RowToAttrib))
+	bases := make([][2]*bn256.G1, len(lambdas))
+	for i, id := range msp.RowToAttrib {
+		lambdas[i], _ = sample.NewUniform(pvgss.P).Sample()
+		d.Shares = append(d.Shares, &PvShare{ID: id,
+			V: new(bn256.G1).ScalarMult(pvgss.G1, lambdas[i]),
+			C: new(bn256.G1).ScalarMult(pks[id], lambdas[i])})
+		bases[i] = [2]*bn256.G1{pvgss.G1, pks[id]}
+	}
+	d.Proof = proveDLEQ("PvGSS:share", bases, distributionPoints(d), lambdas)
+	assert.True(t, verifyDLEQ("PvGSS:share", bases, distributionPoints(d), d.Proof))
+	assert.False(t, pvgss.Verify(d, pks))
+}
@@ -0,0 +1,331 @@
+package pvgss_lsss
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+	lib "github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/sample"
+)
+
+// PVGSS in the style of SCRAPE. The secret is H^s for a generator H whose
+// discrete log to G1 nobody knows. For the GSS shares λi of s over the MSP
+// the dealer publishes
+//
+//	Vi = G1^{λi}, Ci = pki^{λi} with pki = H^{ski}, Com = G1^s
+//
+// and one DLEQ proof that log_G1 Vi = log_pki Ci for every row. Anyone checks
+// that the Vi are a sharing of the secret in Com by the dual code: H·V = 0 for
+// every row h of LSSS.GenerateParityMatrix. Holder i decrypts
+// Si = Ci^{1/ski} = H^{λi} and proves log_H pki = log_Si Ci, so a public
+// arbiter can check the shares it reconstructs H^s from.
+
+// PvShare is the public part of the share of one MSP row.
+type PvShare struct {
+	ID string
+	V  *bn256.G1 // V = G1^λ
+	C  *bn256.G1 // C = pk^λ
+}
+
+// PvDistribution is a verifiable sharing of H^s.
+type PvDistribution struct {
+	MSP    *lib.MSP
+	Com    *bn256.G1 // Com = G1^s
+	Shares []*PvShare
+	Proof  *DLEQProof
+}
+
+// DecShare is the share of one MSP row decrypted by its holder.
+type DecShare struct {
+	Row   int
+	ID    string
+	S     *bn256.G1 // S = H^λ
+	Proof *DLEQProof
+}
+
+// DLEQProof proves equal discrete logs of (X1, X2) to the bases (B1, B2),
+// for one or more tuples sharing a challenge.
+type DLEQProof struct {
+	C *big.Int
+	Z []*big.Int
+}
+
+// KeyGen returns a holder key pair (sk, H^sk).
+func (p *PvGSS) KeyGen() (*big.Int, *bn256.G1) {
+	sampler := sample.NewUniformRange(big.NewInt(1), p.P)
+	sk, _ := sampler.Sample()
+	return sk, new(bn256.G1).ScalarMult(p.H, sk)
+}
+
+// Share shares H^s over msp, encrypting the share of row i to pks[ρ(i)]. A
+// holder may own several rows.
+func (p *PvGSS) Share(s *big.Int, msp *lib.MSP, pks map[string]*bn256.G1) (*PvDistribution, error) {
+	//Unlike LSSShare a holder may own several rows, each row's share is
+	//encrypted and proved on its own
+	if len(msp.Mat) == 0 || len(msp.Mat[0]) == 0 {
+		return nil, fmt.Errorf("empty msp matrix")
+	}
+	v, err := data.NewRandomVector(msp.Mat.Cols(), sample.NewUniform(p.P))
+	if err != nil {
+		return nil, err
+	}
+	v[0] = s
+	lambdaI, err := msp.Mat.MulVec(v)
+	if err != nil {
+		return nil, err
+	}
+	d := &PvDistribution{MSP: msp, Com: new(bn256.G1).ScalarMult(p.G1, s)}
+	lambdas := make([]*big.Int, len(lambdaI))
+	bases := make([][2]*bn256.G1, len(lambdaI))
+	for i, id := range msp.RowToAttrib {
+		pk := pks[id]
+		if pk == nil {
+			return nil, fmt.Errorf("no public key for holder %s", id)
+		}
+		lambdas[i] = new(big.Int).Mod(lambdaI[i], p.P)
+		d.Shares = append(d.Shares, &PvShare{
+			ID: id,
+			V:  new(bn256.G1).ScalarMult(p.G1, lambdas[i]),
+			C:  new(bn256.G1).ScalarMult(pk, lambdas[i]),
+		})
+		bases[i] = [2]*bn256.G1{p.G1, pk}
+	}
+	d.Proof = proveDLEQ("PvGSS:share", bases, distributionPoints(d), lambdas)
+	return d, nil
+}
+
+// Verify checks a distribution against the holders' public keys.
+func (p *PvGSS) Verify(d *PvDistribution, pks map[string]*bn256.G1) bool {
+	if !wellShaped(d) || d.Com == nil {
+		return false
+	}
+	bases := make([][2]*bn256.G1, len(d.Shares))
+	V := make([]*bn256.G1, len(d.Shares))
+	for i, share := range d.Shares {
+		if share == nil || share.V == nil || share.C == nil || share.ID != d.MSP.RowToAttrib[i] || pks[share.ID] == nil {
+			return false
+		}
+		bases[i] = [2]*bn256.G1{p.G1, pks[share.ID]}
+		V[i] = share.V
+	}
+	if !verifyDLEQ("PvGSS:share", bases, distributionPoints(d), d.Proof) {
+		return false
+	}
+	//Dual code check: h·V = 0 for the parity matrix of the MSP
+	matrix := modMatrix(d.MSP.Mat, p.P)
+	zero := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for _, h := range LSSS.GenerateParityMatrix(matrix, p.P) {
+		if !Operation.G1Equal(combine(V, h, p.P), zero) {
+			return false
+		}
+	}
+	//The shared secret is the one in Com
+	all := make([]int, len(V))
+	for i := range all {
+		all[i] = i
+	}
+	c, err := reconCoeffs(d.MSP, all, p.P)
+	if err != nil {
+		return false
+	}
+	return Operation.G1Equal(combine(V, c, p.P), d.Com)
+}
+
+// DecryptShare decrypts the shares of all rows of holder id with its secret
+// key, one DecShare per row.
+func (p *PvGSS) DecryptShare(d *PvDistribution, id string, sk *big.Int) ([]*DecShare, error) {
+	skInv := new(big.Int).ModInverse(sk, p.P)
+	if skInv == nil {
+		return nil, fmt.Errorf("invalid secret key")
+	}
+	pk := new(bn256.G1).ScalarMult(p.H, sk)
+	var decShares []*DecShare
+	for i, share := range d.Shares {
+		if share.ID != id {
+			continue
+		}
+		S := new(bn256.G1).ScalarMult(share.C, skInv)
+		proof := proveDLEQ("PvGSS:dec", [][2]*bn256.G1{{p.H, S}}, [][2]*bn256.G1{{pk, share.C}}, []*big.Int{sk})
+		decShares = append(decShares, &DecShare{Row: i, ID: id, S: S, Proof: proof})
+	}
+	if len(decShares) == 0 {
+		return nil, fmt.Errorf("no share for holder %s", id)
+	}
+	return decShares, nil
+}
+
+// VerifyDecShare checks a decrypted share against the holder's public key.
+func (p *PvGSS) VerifyDecShare(d *PvDistribution, pk *bn256.G1, ds *DecShare) bool {
+	if ds == nil || ds.S == nil || pk == nil || ds.Row < 0 || ds.Row >= len(d.Shares) {
+		return false
+	}
+	share := d.Shares[ds.Row]
+	if share == nil || share.ID != ds.ID {
+		return false
+	}
+	return verifyDLEQ("PvGSS:dec", [][2]*bn256.G1{{p.H, ds.S}}, [][2]*bn256.G1{{pk, share.C}}, ds.Proof)
+}
+
+// Recon checks the decrypted shares and reconstructs H^s from them.
+func (p *PvGSS) Recon(d *PvDistribution, pks map[string]*bn256.G1, decShares []*DecShare) (*bn256.G1, error) {
+	if !wellShaped(d) {
+		return nil, fmt.Errorf("malformed distribution")
+	}
+	byRow := make(map[int]*DecShare)
+	for _, ds := range decShares {
+		if ds == nil {
+			return nil, fmt.Errorf("missing decrypted share")
+		}
+		if !p.VerifyDecShare(d, pks[ds.ID], ds) {
+			return nil, fmt.Errorf("invalid decrypted share of holder %s for row %d", ds.ID, ds.Row)
+		}
+		byRow[ds.Row] = ds
+	}
+	var rows []int
+	var S []*bn256.G1
+	for i := range d.Shares {
+		if byRow[i] != nil {
+			rows = append(rows, i)
+			S = append(S, byRow[i].S)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no decrypted shares")
+	}
+	c, err := reconCoeffs(d.MSP, rows, p.P)
+	if err != nil {
+		return nil, err
+	}
+	return combine(S, c, p.P), nil
+}
+
+// wellShaped tells whether the MSP of d has one holder and one share per row
+// and rows of a single width, so d can be indexed without checks.
+func wellShaped(d *PvDistribution) bool {
+	if d == nil || d.MSP == nil || len(d.MSP.Mat) == 0 || len(d.MSP.Mat[0]) == 0 {
+		return false
+	}
+	if len(d.MSP.RowToAttrib) != len(d.MSP.Mat) || len(d.Shares) != len(d.MSP.Mat) {
+		return false
+	}
+	for _, row := range d.MSP.Mat {
+		if len(row) != len(d.MSP.Mat[0]) {
+			return false
+		}
+		for _, x := range row {
+			if x == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// distributionPoints returns the (V, C) pairs proved by the dealer.
+func distributionPoints(d *PvDistribution) [][2]*bn256.G1 {
+	points := make([][2]*bn256.G1, len(d.Shares))
+	for i, share := range d.Shares {
+		points[i] = [2]*bn256.G1{share.V, share.C}
+	}
+	return points
+}
+
+// proveDLEQ proves log_{bases[i][0]} points[i][0] = log_{bases[i][1]} points[i][1]
+// = x[i] for all i under one challenge.
+func proveDLEQ(tag string, bases, points [][2]*bn256.G1, x []*big.Int) *DLEQProof {
+	sampler := sample.NewUniformRange(big.NewInt(1), bn256.Order)
+	rho := make([]*big.Int, len(x))
+	h := dleqStatement(tag, bases, points)
+	for i := range x {
+		rho[i], _ = sampler.Sample()
+		writeG1(h, new(bn256.G1).ScalarMult(bases[i][0], rho[i]))
+		writeG1(h, new(bn256.G1).ScalarMult(bases[i][1], rho[i]))
+	}
+	c := dleqChallenge(h)
+	proof := &DLEQProof{C: c, Z: make([]*big.Int, len(x))}
+	for i := range x {
+		z := new(big.Int).Sub(rho[i], new(big.Int).Mul(c, x[i]))
+		proof.Z[i] = z.Mod(z, bn256.Order)
+	}
+	return proof
+}
+
+func verifyDLEQ(tag string, bases, points [][2]*bn256.G1, proof *DLEQProof) bool {
+	if proof == nil || proof.C == nil || len(proof.Z) != len(bases) || len(points) != len(bases) {
+		return false
+	}
+	h := dleqStatement(tag, bases, points)
+	for i, z := range proof.Z {
+		if z == nil || points[i][0] == nil || points[i][1] == nil {
+			return false
+		}
+		for k := 0; k < 2; k++ {
+			a := new(bn256.G1).Add(new(bn256.G1).ScalarMult(bases[i][k], z), new(bn256.G1).ScalarMult(points[i][k], proof.C))
+			writeG1(h, a)
+		}
+	}
+	return Operation.BigIntEqual(dleqChallenge(h), proof.C)
+}
+
+func dleqStatement(tag string, bases, points [][2]*bn256.G1) hash.Hash {
+	h := sha256.New()
+	h.Write([]byte(tag))
+	for i := range bases {
+		writeG1(h, bases[i][0])
+		writeG1(h, bases[i][1])
+		writeG1(h, points[i][0])
+		writeG1(h, points[i][1])
+	}
+	return h
+}
+
+func dleqChallenge(h hash.Hash) *big.Int {
+	return new(big.Int).Mod(new(big.Int).SetBytes(h.Sum(nil)), bn256.Order)
+}
+
+func writeG1(h hash.Hash, p *bn256.G1) {
+	b := p.Marshal()
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// combine returns ∑ w[i]·points[i].
+func combine(points []*bn256.G1, w []*big.Int, p *big.Int) *bn256.G1 {
+	sum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for i, x := range w {
+		sum.Add(sum, new(bn256.G1).ScalarMult(points[i], new(big.Int).Mod(x, p)))
+	}
+	return sum
+}
+
+// reconCoeffs returns c with ∑c[k]·Mat[rows[k]] = (1,0,...,0).
+func reconCoeffs(msp *lib.MSP, rows []int, p *big.Int) ([]*big.Int, error) {
+	mat := make(data.Matrix, len(rows))
+	for k, i := range rows {
+		mat[k] = msp.Mat[i]
+	}
+	one := data.NewConstantVector(msp.Mat.Cols(), big.NewInt(0))
+	one[0] = big.NewInt(1)
+	return data.GaussianEliminationSolver(mat.Transpose(), one, p)
+}
+
+// modMatrix copies the MSP matrix with entries reduced mod p.
+func modMatrix(mat data.Matrix, p *big.Int) [][]*big.Int {
+	out := make([][]*big.Int, len(mat))
+	for i, row := range mat {
+		out[i] = make([]*big.Int, len(row))
+		for j, x := range row {
+			out[i][j] = new(big.Int).Mod(x, p)
+		}
+	}
+	return out
+}
@@ -2,6 +2,8 @@ package Operation
 
 import (
 	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
 	"math/big"
 	"sort"
 
@@ -41,6 +43,13 @@ func G1Equal(a, b *bn256.G1) bool {
 	return bytes.Equal(a.Marshal(), b.Marshal())
 }
 
+func G2Equal(a, b *bn256.G2) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
 func BigIntEqual(a, b *big.Int) bool {
 	return a.Cmp(b) == 0 // 如果 a 和 b 相等，返回 true
 }
@@ -49,3 +58,27 @@ func RandomInt() *big.Int {
 	v, _ := data.NewRandomVector(1, sample.NewUniform(bn256.Order))
 	return v[0]
 }
+
+// OracleSampler derives scalars in [1, Order) from a seed, the i-th one being
+// SHA512(seed, i) mod (Order-1) + 1. It stands in for the random oracle that
+// fixes the encryption randomness of the CCA modes.
+type OracleSampler struct {
+	seed []byte
+	ctr  uint64
+}
+
+func NewOracleSampler(seed []byte) *OracleSampler {
+	return &OracleSampler{seed: append([]byte{}, seed...)}
+}
+
+func (s *OracleSampler) Sample() (*big.Int, error) {
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], s.ctr)
+	s.ctr++
+	h := sha512.New()
+	h.Write(s.seed)
+	h.Write(ctr[:])
+	x := new(big.Int).SetBytes(h.Sum(nil))
+	x.Mod(x, new(big.Int).Sub(bn256.Order, big.NewInt(1)))
+	return x.Add(x, big.NewInt(1)), nil
+}
@@ -0,0 +1,122 @@
+package Policy
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+)
+
+// NumBits is the width of numeric attribute values.
+const NumBits = 32
+
+// A numeric attribute name with value x is held as the NumBits attributes
+// "name#i=b", b being bit i of x. A comparison with a constant c becomes a
+// tree over these bit attributes: walking from the most significant bit,
+// x > c holds if x has a 1 where c has a 0 and agrees with c above it.
+
+// BitAttr is the attribute stating that bit i of the value of name is b.
+func BitAttr(name string, i int, b uint64) string {
+	return fmt.Sprintf("%s#%d=%d", name, i, b)
+}
+
+// NumericAttrs returns the attributes a key holds for name = value.
+func NumericAttrs(name string, value uint64) ([]string, error) {
+	if value >= 1<<NumBits {
+		return nil, fmt.Errorf("value %d of %s does not fit in %d bits", value, name, NumBits)
+	}
+	attrs := make([]string, NumBits)
+	for i := range attrs {
+		attrs[i] = BitAttr(name, i, value>>uint(i)&1)
+	}
+	return attrs, nil
+}
+
+// ParseValue reads a comparison constant: a decimal number or a month written
+// as YYYY-MM, counted as 12*YYYY+MM-1.
+func ParseValue(s string) (uint64, error) {
+	if year, month, ok := strings.Cut(s, "-"); ok {
+		y, err1 := strconv.ParseUint(year, 10, 32)
+		m, err2 := strconv.ParseUint(month, 10, 8)
+		if err1 != nil || err2 != nil || len(year) != 4 || len(month) != 2 || m < 1 || m > 12 {
+			return 0, fmt.Errorf("invalid month %q", s)
+		}
+		return 12*y + m - 1, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func compare(name, op string, c uint64) (*LSSS.Node, error) {
+	const max = 1<<NumBits - 1
+	var n *LSSS.Node
+	switch {
+	case op == "==" && c <= max:
+		var bits []*LSSS.Node
+		for i := NumBits - 1; i >= 0; i-- {
+			bits = append(bits, bitLeaf(name, i, c>>uint(i)&1))
+		}
+		n = gate(len(bits), bits)
+	case op == ">" && c < max:
+		n = greater(name, c, NumBits-1)
+	case op == ">=" && c >= 1 && c <= max:
+		n = greater(name, c-1, NumBits-1)
+	case op == ">=" && c == 0, op == "<=" && c >= max, op == "<" && c > max:
+		return nil, fmt.Errorf("comparison %s %s %d always holds", name, op, c)
+	case op == "<" && c >= 1:
+		n = less(name, c, NumBits-1)
+	case op == "<=":
+		n = less(name, c+1, NumBits-1)
+	}
+	if n == nil {
+		return nil, fmt.Errorf("comparison %s %s %d never holds", name, op, c)
+	}
+	return n, nil
+}
+
+func bitLeaf(name string, i int, b uint64) *LSSS.Node {
+	return LSSS.NewLeaf(BitAttr(name, i, b), big.NewInt(0))
+}
+
+// greater returns the tree for x > c on bits i..0, or nil if it cannot hold.
+func greater(name string, c uint64, i int) *LSSS.Node {
+	if i < 0 {
+		return nil
+	}
+	rest := greater(name, c, i-1)
+	one := bitLeaf(name, i, 1)
+	if c>>uint(i)&1 == 1 {
+		if rest == nil {
+			return nil
+		}
+		return gate(2, []*LSSS.Node{one, rest})
+	}
+	if rest == nil {
+		return one
+	}
+	return gate(1, []*LSSS.Node{one, rest})
+}
+
+// less returns the tree for x < c on bits i..0, or nil if it cannot hold.
+func less(name string, c uint64, i int) *LSSS.Node {
+	if i < 0 {
+		return nil
+	}
+	rest := less(name, c, i-1)
+	zero := bitLeaf(name, i, 0)
+	if c>>uint(i)&1 == 0 {
+		if rest == nil {
+			return nil
+		}
+		return gate(2, []*LSSS.Node{zero, rest})
+	}
+	if rest == nil {
+		return zero
+	}
+	return gate(1, []*LSSS.Node{zero, rest})
+}
@@ -0,0 +1,231 @@
+// Package Policy compiles access policies into LSSS access trees and MSPs.
+//
+// The policy language extends the AND/OR expressions of abe.BooleanToMSP:
+//
+//	policy := and { "OR" and }
+//	and    := unit { "AND" unit }
+//	unit   := "(" policy ")"
+//	        | k "of" "(" policy { "," policy } ")"   k-of-n threshold gate
+//	        | attr [ op value ]                      attribute or comparison
+//	op     := "<" | "<=" | ">" | ">=" | "=="
+//
+// Comparisons such as "age >= 18" or "expiry < 2027-01" are expanded over the
+// bits of a NumBits-bit value, see Numeric.go. An attribute may appear any
+// number of times; schemes using the result must give every row its own
+// randomness.
+package Policy
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/abe"
+	"github.com/fentec-project/gofe/data"
+)
+
+// Parse compiles policy into an access tree whose leaves are labelled with
+// attributes. Leaves may share a label.
+func Parse(policy string) (*LSSS.Node, error) {
+	p := &parser{tokens: tokenize(policy)}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in policy", p.tokens[p.pos])
+	}
+	root.Idx = big.NewInt(0)
+	return root, nil
+}
+
+// Compile compiles policy into an MSP with one row per leaf of Parse(policy).
+func Compile(policy string) (*abe.MSP, error) {
+	root, err := Parse(policy)
+	if err != nil {
+		return nil, err
+	}
+	return TreeToMSP(root), nil
+}
+
+// TreeToMSP converts an access tree into an MSP over Zp. The rows follow
+// LSSS.Leaves and the target vector is (1,0,...,0).
+func TreeToMSP(root *LSSS.Node) *abe.MSP {
+	matrix := LSSS.Convert(root)
+	mat := make(data.Matrix, len(matrix))
+	for i, row := range matrix {
+		mat[i] = make(data.Vector, len(row))
+		for j, x := range row {
+			mat[i][j] = new(big.Int).Mod(x, bn256.Order)
+		}
+	}
+	var labels []string
+	for _, leaf := range LSSS.Leaves(root) {
+		labels = append(labels, leaf.Label)
+	}
+	return &abe.MSP{P: bn256.Order, Mat: mat, RowToAttrib: labels}
+}
+
+// gate returns a t-of-n gate over children, or the only child.
+func gate(t int, children []*LSSS.Node) *LSSS.Node {
+	if len(children) == 1 {
+		return children[0]
+	}
+	n := LSSS.NewNode(false, len(children), t, big.NewInt(0))
+	for i, child := range children {
+		child.Idx = big.NewInt(int64(i + 1))
+	}
+	n.Children = children
+	return n
+}
+
+func tokenize(policy string) []string {
+	var tokens []string
+	for i := 0; i < len(policy); {
+		c, size := utf8.DecodeRuneInString(policy[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case strings.ContainsRune("(),", c):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("<>=", c):
+			j := i + 1
+			if j < len(policy) && policy[j] == '=' {
+				j++
+			}
+			tokens = append(tokens, policy[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(policy) {
+				r, n := utf8.DecodeRuneInString(policy[j:])
+				if unicode.IsSpace(r) || strings.ContainsRune("(),<>=", r) {
+					break
+				}
+				j += n
+			}
+			tokens = append(tokens, policy[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) expect(tok string) error {
+	if p.peek() != tok {
+		return fmt.Errorf("expected %q in policy, got %q", tok, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) or() (*LSSS.Node, error) {
+	var children []*LSSS.Node
+	for {
+		n, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+		if p.peek() != "OR" {
+			return gate(1, children), nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) and() (*LSSS.Node, error) {
+	var children []*LSSS.Node
+	for {
+		n, err := p.unit()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+		if p.peek() != "AND" {
+			return gate(len(children), children), nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) unit() (*LSSS.Node, error) {
+	tok := p.peek()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of policy")
+	case "(":
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case ")", ",", "AND", "OR", "of", "<", "<=", ">", ">=", "==":
+		return nil, fmt.Errorf("unexpected %q in policy", tok)
+	}
+	p.pos++
+	// k of (...)
+	if p.peek() == "of" {
+		k, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold %q", tok)
+		}
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var children []*LSSS.Node
+		for {
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, n)
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if k < 1 || k > len(children) {
+			return nil, fmt.Errorf("invalid %d-of-%d gate", k, len(children))
+		}
+		if len(children) == 1 {
+			return children[0], nil
+		}
+		return gate(k, children), nil
+	}
+	// attr op value
+	switch op := p.peek(); op {
+	case "<", "<=", ">", ">=", "==":
+		p.pos++
+		value, err := ParseValue(p.peek())
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		return compare(tok, op, value)
+	}
+	return LSSS.NewLeaf(tok, big.NewInt(0)), nil
+}
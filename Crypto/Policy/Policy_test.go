@@ -0,0 +1,94 @@
+package Policy
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/WXY1313/Trade/Crypto/LSSS"
+	"github.com/fentec-project/bn256"
+	"github.com/stretchr/testify/require"
+)
+
+// satisfies checks that labels satisfy the tree of policy and that the
+// matching MSP rows reconstruct the secret.
+func satisfies(t *testing.T, policy string, labels []string) bool {
+	root, err := Parse(policy)
+	require.NoError(t, err)
+	have := make(map[string]bool)
+	for _, label := range labels {
+		have[label] = true
+	}
+	rows, err := LSSS.AuthorizedRows(root, have)
+	if err != nil {
+		return false
+	}
+	msp := TreeToMSP(root)
+	matrix := make([][]*big.Int, len(msp.Mat))
+	for i := range msp.Mat {
+		matrix[i] = msp.Mat[i]
+	}
+	_, err = LSSS.ReconCoeffs(matrix, rows, bn256.Order)
+	require.NoError(t, err)
+	return true
+}
+
+func TestThreshold(t *testing.T) {
+	policy := "2 of (A, B AND C, 1 of (D, E)) OR F"
+	require.True(t, satisfies(t, policy, []string{"A", "E"}))
+	require.True(t, satisfies(t, policy, []string{"B", "C", "D"}))
+	require.True(t, satisfies(t, policy, []string{"F"}))
+	require.False(t, satisfies(t, policy, []string{"A", "B"}))
+	require.False(t, satisfies(t, policy, []string{"D", "E"}))
+
+	//Repeated attributes label several rows
+	msp, err := Compile("(A AND B) OR (A AND C)")
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "A", "C"}, msp.RowToAttrib)
+
+	//Multi-byte attributes are kept whole, U+00A0 and U+0085 separate them
+	msp, err = Compile("dept:à AND city:Zürich AND\u0085name:Łódź")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dept:à", "city:Zürich", "name:Łódź"}, msp.RowToAttrib)
+
+	for _, bad := range []string{"", "A AND", "(A OR B", "3 of (A, B)", "0 of (A)", "A B", "age >= x"} {
+		_, err := Parse(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	key := func(name string, v uint64) []string {
+		attrs, err := NumericAttrs(name, v)
+		require.NoError(t, err)
+		return attrs
+	}
+	for _, c := range []uint64{1, 18, 255, 256, 1000} {
+		for _, x := range []uint64{0, 1, 17, 18, 19, 255, 256, 257, 999, 1000, 1001, 1<<NumBits - 1} {
+			attrs := key("age", x)
+			require.Equal(t, x > c, satisfies(t, "age > "+itoa(c), attrs))
+			require.Equal(t, x >= c, satisfies(t, "age >= "+itoa(c), attrs))
+			require.Equal(t, x < c, satisfies(t, "age < "+itoa(c), attrs))
+			require.Equal(t, x <= c, satisfies(t, "age <= "+itoa(c), attrs))
+			require.Equal(t, x == c, satisfies(t, "age == "+itoa(c), attrs))
+		}
+	}
+
+	//Months and combined comparisons over the same bits
+	v, err := ParseValue("2026-12")
+	require.NoError(t, err)
+	attrs := append(key("expiry", v), key("age", 30)...)
+	policy := "expiry < 2027-01 AND age >= 18 AND age < 65"
+	require.True(t, satisfies(t, policy, attrs))
+	require.False(t, satisfies(t, policy, append(key("expiry", v), key("age", 70)...)))
+	v, _ = ParseValue("2027-01")
+	require.False(t, satisfies(t, policy, append(key("expiry", v), key("age", 30)...)))
+
+	for _, bad := range []string{"age >= 0", "age < 0", "age > 4294967295", "expiry < 2027-13"} {
+		_, err := Parse(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func itoa(v uint64) string {
+	return new(big.Int).SetUint64(v).String()
+}
@@ -119,3 +119,152 @@ func evalPoly(coeffs []*big.Int, x *big.Int, q *big.Int) *big.Int {
 	}
 	return result
 }
+
+// RSDecode decodes the Reed-Solomon codeword ys, evaluated at the distinct
+// non-zero points xs, with the Berlekamp-Welch algorithm. It returns the k
+// coefficients of the polynomial P of degree < k and the positions i with
+// P(xs[i]) != ys[i], of which there may be at most (n-k)/2.
+func RSDecode(xs, ys []*big.Int, k int) ([]*big.Int, []int, error) {
+	n := len(ys)
+	if len(xs) != n || k < 1 || n < k {
+		return nil, nil, fmt.Errorf("cannot decode %d shares with threshold %d", n, k)
+	}
+	q := bn256.Order
+	seen := make(map[string]bool)
+	for i, x := range xs {
+		if x == nil || ys[i] == nil {
+			return nil, nil, fmt.Errorf("share %d is missing", i)
+		}
+		xm := new(big.Int).Mod(x, q)
+		if xm.Sign() == 0 {
+			return nil, nil, fmt.Errorf("share %d is at x = 0", i)
+		}
+		if seen[xm.String()] {
+			return nil, nil, fmt.Errorf("x = %s appears more than once", xm)
+		}
+		seen[xm.String()] = true
+	}
+	e := (n - k) / 2
+	// Find E monic of degree e and Q of degree < k+e with Q(xi) = yi·E(xi):
+	// ∑ qj·xi^j - yi·∑_{j<e} ej·xi^j = yi·xi^e
+	cols := k + 2*e
+	A := make([][]*big.Int, n)
+	b := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		A[i] = make([]*big.Int, cols)
+		xPow := big.NewInt(1)
+		for j := 0; j < k+e; j++ {
+			A[i][j] = new(big.Int).Set(xPow)
+			if j < e {
+				t := new(big.Int).Mul(ys[i], xPow)
+				A[i][k+e+j] = t.Neg(t).Mod(t, q)
+			}
+			xPow = new(big.Int).Mul(xPow, xs[i])
+			xPow.Mod(xPow, q)
+		}
+		b[i] = new(big.Int).Mul(ys[i], new(big.Int).Exp(xs[i], big.NewInt(int64(e)), q))
+		b[i].Mod(b[i], q)
+	}
+	sol, err := solveMod(A, b, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("too many corrupted shares")
+	}
+	E := append(sol[k+e:], big.NewInt(1))
+	P, rem := polyDiv(sol[:k+e], E, q)
+	for _, r := range rem {
+		if r.Sign() != 0 {
+			return nil, nil, fmt.Errorf("too many corrupted shares")
+		}
+	}
+	P = P[:k]
+	var bad []int
+	for i := 0; i < n; i++ {
+		if evalPoly(P, xs[i], q).Cmp(new(big.Int).Mod(ys[i], q)) != 0 {
+			bad = append(bad, i)
+		}
+	}
+	if len(bad) > e {
+		return nil, nil, fmt.Errorf("too many corrupted shares")
+	}
+	return P, bad, nil
+}
+
+// solveMod returns a solution of A·x = b mod q, free variables set to 0.
+func solveMod(A [][]*big.Int, b []*big.Int, q *big.Int) ([]*big.Int, error) {
+	rows := len(A)
+	cols := len(A[0])
+	M := make([][]*big.Int, rows)
+	for i := range A {
+		M[i] = make([]*big.Int, cols+1)
+		for j := range A[i] {
+			M[i][j] = new(big.Int).Mod(A[i][j], q)
+		}
+		M[i][cols] = new(big.Int).Mod(b[i], q)
+	}
+	pivots := make([]int, 0, cols)
+	r := 0
+	for c := 0; c < cols && r < rows; c++ {
+		p := -1
+		for i := r; i < rows; i++ {
+			if M[i][c].Sign() != 0 {
+				p = i
+				break
+			}
+		}
+		if p < 0 {
+			continue
+		}
+		M[r], M[p] = M[p], M[r]
+		inv := new(big.Int).ModInverse(M[r][c], q)
+		for j := c; j <= cols; j++ {
+			M[r][j].Mul(M[r][j], inv).Mod(M[r][j], q)
+		}
+		for i := 0; i < rows; i++ {
+			if i == r || M[i][c].Sign() == 0 {
+				continue
+			}
+			f := new(big.Int).Set(M[i][c])
+			for j := c; j <= cols; j++ {
+				t := new(big.Int).Mul(f, M[r][j])
+				M[i][j].Sub(M[i][j], t).Mod(M[i][j], q)
+			}
+		}
+		pivots = append(pivots, c)
+		r++
+	}
+	for i := r; i < rows; i++ {
+		if M[i][cols].Sign() != 0 {
+			return nil, fmt.Errorf("inconsistent system")
+		}
+	}
+	x := make([]*big.Int, cols)
+	for j := range x {
+		x[j] = big.NewInt(0)
+	}
+	for i, c := range pivots {
+		x[c] = M[i][cols]
+	}
+	return x, nil
+}
+
+// polyDiv divides num by the monic den and returns quotient and remainder.
+func polyDiv(num, den []*big.Int, q *big.Int) ([]*big.Int, []*big.Int) {
+	rem := make([]*big.Int, len(num))
+	for i := range num {
+		rem[i] = new(big.Int).Set(num[i])
+	}
+	d := len(den) - 1
+	if len(num) <= d {
+		return []*big.Int{}, rem
+	}
+	quot := make([]*big.Int, len(num)-d)
+	for i := len(num) - 1; i >= d; i-- {
+		c := new(big.Int).Mod(rem[i], q)
+		quot[i-d] = c
+		for j := 0; j <= d; j++ {
+			t := new(big.Int).Mul(c, den[j])
+			rem[i-d+j].Sub(rem[i-d+j], t).Mod(rem[i-d+j], q)
+		}
+	}
+	return quot, rem[:d]
+}
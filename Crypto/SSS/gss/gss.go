@@ -3,9 +3,12 @@ package gss
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/WXY1313/Trade/Crypto/SSS/sss"
+	"github.com/fentec-project/bn256"
 )
 
 type Node struct {
@@ -14,6 +17,7 @@ type Node struct {
 	Childrennum int
 	T           int
 	Idx         *big.Int
+	Label       string // names the holder of a leaf's share
 }
 
 func GSSShare(secret *big.Int, AA *Node) ([]*big.Int, error) {
@@ -79,6 +83,111 @@ func GSSRecon(AA *Node, Q []*big.Int) (*big.Int, *big.Int, error) {
 	return recovered, AA.Idx, nil
 }
 
+// GSSReconTree reconstructs the secret from the full access tree AA and the
+// shares keyed by leaf label. At every gate it uses the T satisfied children
+// whose own reconstruction costs least, summing cost over the leaves used; a
+// nil cost counts every leaf as 1. The leaf labels must be distinct and
+// non-empty.
+func GSSReconTree(AA *Node, shares map[string]*big.Int, cost func(label string) int) (*big.Int, error) {
+	if AA == nil {
+		return nil, errors.New("AA is empty")
+	}
+	if err := checkLabels(AA); err != nil {
+		return nil, err
+	}
+	if cost == nil {
+		cost = func(string) int { return 1 }
+	}
+	s, _, ok, err := reconTree(AA, shares, cost)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("shares do not satisfy the access tree")
+	}
+	return s, nil
+}
+
+// checkLabels checks that every leaf of AA has its own label.
+func checkLabels(AA *Node) error {
+	labels := make(map[string]bool)
+	for _, leaf := range Leaves(AA) {
+		if leaf.Label == "" {
+			return errors.New("access tree leaf without label")
+		}
+		if labels[leaf.Label] {
+			return fmt.Errorf("label %s on more than one leaf", leaf.Label)
+		}
+		labels[leaf.Label] = true
+	}
+	return nil
+}
+
+func reconTree(AA *Node, shares map[string]*big.Int, cost func(string) int) (*big.Int, int, bool, error) {
+	if AA.IsLeaf {
+		if shares[AA.Label] == nil {
+			return nil, 0, false, nil
+		}
+		return shares[AA.Label], cost(AA.Label), true, nil
+	}
+	if AA.T < 1 || AA.T > len(AA.Children) {
+		return nil, 0, false, fmt.Errorf("invalid %d-of-%d gate", AA.T, len(AA.Children))
+	}
+	type choice struct {
+		share *big.Int
+		idx   *big.Int
+		cost  int
+	}
+	var choices []choice
+	for _, child := range AA.Children {
+		share, c, ok, err := reconTree(child, shares, cost)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if ok {
+			choices = append(choices, choice{share, child.Idx, c})
+		}
+	}
+	if len(choices) < AA.T {
+		return nil, 0, false, nil
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].cost < choices[j].cost })
+	I := make([]*big.Int, AA.T)
+	for k := range I {
+		I[k] = choices[k].idx
+	}
+	lambdas, err := sss.PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	s := big.NewInt(0)
+	total := 0
+	for k, lambda := range lambdas {
+		s.Add(s, new(big.Int).Mul(lambda, choices[k].share))
+		total += choices[k].cost
+	}
+	return s.Mod(s, bn256.Order), total, true, nil
+}
+
+// NewLeaf returns a leaf whose share is held by the party named label.
+func NewLeaf(label string, idx *big.Int) *Node {
+	leaf := NewNode(true, 0, 1, idx)
+	leaf.Label = label
+	return leaf
+}
+
+// Leaves returns the leaves of AA in the order of the shares of GSSShare.
+func Leaves(AA *Node) []*Node {
+	if AA.IsLeaf {
+		return []*Node{AA}
+	}
+	var leaves []*Node
+	for _, child := range AA.Children {
+		leaves = append(leaves, Leaves(child)...)
+	}
+	return leaves
+}
+
 func NewNode(IsLeaf bool, num int, T int, idx *big.Int) *Node {
 	return &Node{
 		IsLeaf:      IsLeaf,
@@ -53,3 +53,59 @@ func TestGSS(t *testing.T) {
 		t.Errorf("Secret reconstruction mismatch: expected %v, got %v", secret, recoveredSecret)
 	}
 }
+
+func TestGSSReconTree(t *testing.T) {
+	//2-of-(A,B,2-of-(C,D,E))
+	root := NewNode(false, 3, 2, big.NewInt(0))
+	X := NewNode(false, 3, 2, big.NewInt(3))
+	root.Children = []*Node{NewLeaf("A", big.NewInt(1)), NewLeaf("B", big.NewInt(2)), X}
+	X.Children = []*Node{NewLeaf("C", big.NewInt(1)), NewLeaf("D", big.NewInt(2)), NewLeaf("E", big.NewInt(3))}
+
+	secret, _ := rand.Int(rand.Reader, bn256.Order)
+	shares, err := GSSShare(secret, root)
+	if err != nil {
+		t.Fatalf("GSSShare failed: %v", err)
+	}
+	all := make(map[string]*big.Int)
+	for i, leaf := range Leaves(root) {
+		all[leaf.Label] = shares[i]
+	}
+
+	for _, labels := range [][]string{{"A", "B"}, {"B", "C", "E"}, {"A", "B", "C", "D", "E"}} {
+		have := make(map[string]*big.Int)
+		for _, label := range labels {
+			have[label] = all[label]
+		}
+		recovered, err := GSSReconTree(root, have, nil)
+		if err != nil || recovered.Cmp(secret) != 0 {
+			t.Fatalf("GSSReconTree failed for %v: %v", labels, err)
+		}
+	}
+
+	//With A expensive and a wrong share for it, the cheap branch is used
+	have := map[string]*big.Int{"A": big.NewInt(1), "B": all["B"], "C": all["C"], "D": all["D"]}
+	cost := func(label string) int {
+		if label == "A" {
+			return 10
+		}
+		return 1
+	}
+	recovered, err := GSSReconTree(root, have, cost)
+	if err != nil || recovered.Cmp(secret) != 0 {
+		t.Fatalf("GSSReconTree did not pick the cheapest set: %v", err)
+	}
+
+	if _, err := GSSReconTree(root, map[string]*big.Int{"A": all["A"], "C": all["C"]}, nil); err == nil {
+		t.Fatal("GSSReconTree accepted an unauthorized set")
+	}
+
+	//Leaves must carry distinct, non-empty labels
+	X.Children[2].Label = "A"
+	if _, err := GSSReconTree(root, all, nil); err == nil {
+		t.Fatal("GSSReconTree accepted a repeated label")
+	}
+	X.Children[2].Label = ""
+	if _, err := GSSReconTree(root, all, nil); err == nil {
+		t.Fatal("GSSReconTree accepted an empty label")
+	}
+}
@@ -0,0 +1,127 @@
+package sss
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+)
+
+// Proactive refresh and resharing of a Shamir sharing.
+//
+// Refresh: every holder deals a Feldman sharing of 0 with ZeroShare, and
+// holder i adds the zero shares it received to its share. The secret is
+// unchanged but the new polynomial is independent of the old one, so shares
+// from before and after a refresh do not combine.
+//
+// Resharing to n' holders with threshold t': every holder i of an authorized
+// set I deals its own share si with ShareFeldman(si, n', t'). The dealing is
+// tied to the old sharing by VerifyReshare, as its commitment at 0 must be
+// g1^{si} from the old commitments. New holder j combines the sub-shares it
+// received with the Lagrange coefficients of I.
+
+// ZeroShare deals a sharing of 0 for a refresh.
+func ZeroShare(n, t int) ([]*big.Int, []*bn256.G1, error) {
+	return ShareFeldman(big.NewInt(0), n, t)
+}
+
+// VerifyZeroShare checks the zero share of holder i against commits, which
+// must be a sharing of 0 with threshold t.
+func VerifyZeroShare(share *big.Int, i int, commits []*bn256.G1, t int) bool {
+	if len(commits) != t || !Operation.G1Equal(commits[0], new(bn256.G1).ScalarBaseMult(big.NewInt(0))) {
+		return false
+	}
+	return VerifyFeldman(share, i, commits)
+}
+
+// Refresh adds the zero shares holder i received, zeroShares[k] coming with
+// zeroCommits[k], to its share.
+func Refresh(share *big.Int, i int, zeroShares []*big.Int, zeroCommits [][]*bn256.G1, t int) (*big.Int, error) {
+	if len(zeroShares) != len(zeroCommits) {
+		return nil, fmt.Errorf("got %d zero shares for %d dealings", len(zeroShares), len(zeroCommits))
+	}
+	refreshed := new(big.Int).Set(share)
+	for k, zeroShare := range zeroShares {
+		if !VerifyZeroShare(zeroShare, i, zeroCommits[k], t) {
+			return nil, fmt.Errorf("zero share %d is invalid", k)
+		}
+		refreshed.Add(refreshed, zeroShare)
+	}
+	return refreshed.Mod(refreshed, bn256.Order), nil
+}
+
+// RefreshCommits returns the commitments of the refreshed sharing.
+func RefreshCommits(commits []*bn256.G1, zeroCommits [][]*bn256.G1) ([]*bn256.G1, error) {
+	refreshed := make([]*bn256.G1, len(commits))
+	for k, c := range commits {
+		refreshed[k] = new(bn256.G1).Set(c)
+	}
+	for _, zc := range zeroCommits {
+		if len(zc) != len(commits) {
+			return nil, fmt.Errorf("zero sharing has %d commitments, want %d", len(zc), len(commits))
+		}
+		for k, c := range zc {
+			refreshed[k].Add(refreshed[k], c)
+		}
+	}
+	return refreshed, nil
+}
+
+// VerifyReshare checks that commits, dealt by old holder from for a new
+// threshold t, reshare the share committed to in oldCommits.
+func VerifyReshare(oldCommits []*bn256.G1, from int, commits []*bn256.G1, t int) bool {
+	if len(commits) != t {
+		return false
+	}
+	expected, err := CommitmentAt(oldCommits, big.NewInt(int64(from)))
+	if err != nil {
+		return false
+	}
+	return Operation.G1Equal(commits[0], expected)
+}
+
+// CombineReshares computes the share of new holder j from the sub-shares it
+// received from the old holders I, subShares[k] coming with commits[k].
+func CombineReshares(I []*big.Int, j int, subShares []*big.Int, commits [][]*bn256.G1) (*big.Int, error) {
+	if len(subShares) != len(I) || len(commits) != len(I) {
+		return nil, fmt.Errorf("got %d sub-shares and %d dealings for %d holders", len(subShares), len(commits), len(I))
+	}
+	lambdas, err := PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, err
+	}
+	share := big.NewInt(0)
+	for k, subShare := range subShares {
+		if !VerifyFeldman(subShare, j, commits[k]) {
+			return nil, fmt.Errorf("sub-share of holder %v is invalid", I[k])
+		}
+		share.Add(share, new(big.Int).Mul(lambdas[k], subShare))
+	}
+	return share.Mod(share, bn256.Order), nil
+}
+
+// ReshareCommits returns the commitments of the new sharing from the
+// dealings of the old holders I.
+func ReshareCommits(I []*big.Int, commits [][]*bn256.G1) ([]*bn256.G1, error) {
+	if len(commits) != len(I) || len(commits) == 0 {
+		return nil, fmt.Errorf("got %d dealings for %d holders", len(commits), len(I))
+	}
+	lambdas, err := PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, err
+	}
+	reshared := make([]*bn256.G1, len(commits[0]))
+	for k := range reshared {
+		reshared[k] = new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	}
+	for m, cs := range commits {
+		if len(cs) != len(reshared) {
+			return nil, fmt.Errorf("dealing of holder %v has %d commitments, want %d", I[m], len(cs), len(reshared))
+		}
+		for k, c := range cs {
+			reshared[k].Add(reshared[k], new(bn256.G1).ScalarMult(c, lambdas[m]))
+		}
+	}
+	return reshared, nil
+}
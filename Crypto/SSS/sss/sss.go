@@ -12,9 +12,19 @@ import (
 )
 
 func Share(s *big.Int, n, t int) ([]*big.Int, error) {
+	shares, _, err := sharePoly(s, n, t)
+	return shares, err
+}
+
+// sharePoly shares s like Share and also returns the coefficients of the
+// polynomial.
+func sharePoly(s *big.Int, n, t int) ([]*big.Int, []*big.Int, error) {
+	if t < 1 || t > n {
+		return nil, nil, fmt.Errorf("invalid threshold %d for %d shares", t, n)
+	}
 	// Generate the random coefficients of the polynomial
 	cofficients := make([]*big.Int, t)
-	cofficients[0] = s
+	cofficients[0] = new(big.Int).Mod(s, bn256.Order)
 	for i := 1; i < t; i++ {
 		cofficients[i], _ = rand.Int(rand.Reader, bn256.Order)
 	}
@@ -25,7 +35,7 @@ func Share(s *big.Int, n, t int) ([]*big.Int, error) {
 		x := big.NewInt(int64(i + 1))
 		shares[i] = evaluatePolynomial(cofficients, x, bn256.Order)
 	}
-	return shares, nil
+	return shares, cofficients, nil
 }
 
 func Recon(Q []*big.Int, I []*big.Int, threshold int) (*big.Int, error) {
@@ -71,6 +81,23 @@ func Recon(Q []*big.Int, I []*big.Int, threshold int) (*big.Int, error) {
 	return secret, nil
 }
 
+// ReconRobust reconstructs the secret from the shares Q of the holders I even
+// if up to (len(Q)-threshold)/2 of them are wrong, and returns the positions
+// in Q of the wrong shares. The holders must be distinct and non-zero.
+func ReconRobust(Q []*big.Int, I []*big.Int, threshold int) (*big.Int, []int, error) {
+	if len(Q) != len(I) {
+		return nil, nil, fmt.Errorf("got %d shares for %d holders", len(Q), len(I))
+	}
+	if len(Q) < threshold {
+		return nil, nil, fmt.Errorf("not enough shares: got %d, need %d", len(Q), threshold)
+	}
+	coeffs, cheaters, err := RSCode.RSDecode(I, Q, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	return coeffs[0], cheaters, nil
+}
+
 // evaluatePolynomial Compute the value of the polynomial at a given x
 func evaluatePolynomial(coefficients []*big.Int, x, order *big.Int) *big.Int {
 	result := new(big.Int).Set(coefficients[0])
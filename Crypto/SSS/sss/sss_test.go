@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/WXY1313/Trade/Crypto/Operation"
 	"github.com/fentec-project/bn256"
 )
 
@@ -38,3 +39,202 @@ func TestSSS(t *testing.T) {
 		t.Fatal("Recovered secret does not match the original secret")
 	}
 }
+
+func TestReconRobust(t *testing.T) {
+	n, threshold := 7, 3
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	share, err := Share(s, n, threshold)
+	if err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+	I := make([]*big.Int, n)
+	for i := range I {
+		I[i] = big.NewInt(int64(i + 1))
+	}
+
+	//Two holders cheat, (n-threshold)/2 = 2 can be corrected
+	Q := append([]*big.Int{}, share...)
+	Q[1] = new(big.Int).Add(Q[1], big.NewInt(1))
+	Q[5], _ = rand.Int(rand.Reader, bn256.Order)
+	secret, cheaters, err := ReconRobust(Q, I, threshold)
+	if err != nil {
+		t.Fatalf("Error in ReconRobust: %v", err)
+	}
+	if s.Cmp(secret) != 0 {
+		t.Fatal("Recovered secret does not match the original secret")
+	}
+	if len(cheaters) != 2 || cheaters[0] != 1 || cheaters[1] != 5 {
+		t.Fatalf("wrong cheaters %v", cheaters)
+	}
+
+	//Honest shares in any order, no cheater
+	secret, cheaters, err = ReconRobust([]*big.Int{share[6], share[2], share[4]}, []*big.Int{I[6], I[2], I[4]}, threshold)
+	if err != nil || s.Cmp(secret) != 0 || len(cheaters) != 0 {
+		t.Fatalf("ReconRobust failed on honest shares: %v", err)
+	}
+
+	//Three cheaters are too many
+	Q[3] = new(big.Int).Add(Q[3], big.NewInt(1))
+	if _, _, err := ReconRobust(Q, I, threshold); err == nil {
+		t.Fatal("ReconRobust accepted three wrong shares")
+	}
+
+	//Repeated or zero holders are rejected
+	for _, bad := range [][]*big.Int{{I[0], I[1], I[2], I[0]}, {I[0], I[1], I[2], new(big.Int).Add(I[1], bn256.Order)}, {I[0], I[1], I[2], big.NewInt(0)}} {
+		if _, _, err := ReconRobust(share[:4], bad, threshold); err == nil {
+			t.Fatalf("ReconRobust accepted holders %v", bad)
+		}
+	}
+}
+
+func TestVSS(t *testing.T) {
+	n, threshold := 5, 3
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	I := []*big.Int{big.NewInt(2), big.NewInt(4), big.NewInt(5)}
+
+	//Feldman
+	share, commits, err := ShareFeldman(s, n, threshold)
+	if err != nil {
+		t.Fatalf("ShareFeldman failed: %v", err)
+	}
+	for i := range share {
+		if !VerifyFeldman(share[i], i+1, commits) {
+			t.Fatalf("share %d failed the Feldman check", i+1)
+		}
+	}
+	if VerifyFeldman(share[0], 2, commits) || VerifyFeldman(new(big.Int).Add(share[1], big.NewInt(1)), 2, commits) {
+		t.Fatal("VerifyFeldman accepted a wrong share")
+	}
+	if gs, _ := CommitmentAt(commits, big.NewInt(0)); !Operation.G1Equal(gs, new(bn256.G1).ScalarBaseMult(s)) {
+		t.Fatal("commitment at 0 is not g1^s")
+	}
+
+	//Pedersen
+	share, blinds, commits, err := SharePedersen(s, n, threshold)
+	if err != nil {
+		t.Fatalf("SharePedersen failed: %v", err)
+	}
+	for i := range share {
+		if !VerifyPedersen(share[i], blinds[i], i+1, commits) {
+			t.Fatalf("share %d failed the Pedersen check", i+1)
+		}
+	}
+	if VerifyPedersen(share[0], blinds[1], 2, commits) || VerifyPedersen(share[1], blinds[0], 2, commits) {
+		t.Fatal("VerifyPedersen accepted a wrong share")
+	}
+
+	//Reconstruction in the exponent
+	g1Shares := make([]*bn256.G1, len(I))
+	gtShares := make([]*bn256.GT, len(I))
+	for k, i := range I {
+		g1Shares[k] = new(bn256.G1).ScalarBaseMult(share[i.Int64()-1])
+		gtShares[k] = new(bn256.GT).ScalarBaseMult(share[i.Int64()-1])
+	}
+	gs, err := ReconG1(g1Shares, I)
+	if err != nil || !Operation.G1Equal(gs, new(bn256.G1).ScalarBaseMult(s)) {
+		t.Fatalf("ReconG1 failed: %v", err)
+	}
+	es, err := ReconGT(gtShares, I)
+	if err != nil || !Operation.GTEqual(es, new(bn256.GT).ScalarBaseMult(s)) {
+		t.Fatalf("ReconGT failed: %v", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	n, threshold := 5, 3
+	s, _ := rand.Int(rand.Reader, bn256.Order)
+	share, commits, err := ShareFeldman(s, n, threshold)
+	if err != nil {
+		t.Fatalf("ShareFeldman failed: %v", err)
+	}
+
+	//Every holder deals a zero sharing
+	zeroShares := make([][]*big.Int, n)
+	zeroCommits := make([][]*bn256.G1, n)
+	for k := range zeroShares {
+		zeroShares[k], zeroCommits[k], err = ZeroShare(n, threshold)
+		if err != nil {
+			t.Fatalf("ZeroShare failed: %v", err)
+		}
+	}
+	refreshed := make([]*big.Int, n)
+	for i := range refreshed {
+		received := make([]*big.Int, n)
+		for k := range received {
+			received[k] = zeroShares[k][i]
+		}
+		refreshed[i], err = Refresh(share[i], i+1, received, zeroCommits, threshold)
+		if err != nil {
+			t.Fatalf("Refresh failed: %v", err)
+		}
+	}
+	newCommits, err := RefreshCommits(commits, zeroCommits)
+	if err != nil {
+		t.Fatalf("RefreshCommits failed: %v", err)
+	}
+	for i := range refreshed {
+		if !VerifyFeldman(refreshed[i], i+1, newCommits) {
+			t.Fatalf("refreshed share %d failed the Feldman check", i+1)
+		}
+	}
+	I := []*big.Int{big.NewInt(1), big.NewInt(3), big.NewInt(5)}
+	secret, _ := Recon([]*big.Int{refreshed[0], refreshed[2], refreshed[4]}, I, threshold)
+	if s.Cmp(secret) != 0 {
+		t.Fatal("refreshed shares do not reconstruct the secret")
+	}
+	//Old and new shares do not combine
+	secret, _ = Recon([]*big.Int{share[0], refreshed[2], refreshed[4]}, I, threshold)
+	if secret != nil && s.Cmp(secret) == 0 {
+		t.Fatal("old and refreshed shares reconstruct the secret")
+	}
+	//A dealing of a non-zero secret is rejected
+	badShares, badCommits, _ := ShareFeldman(big.NewInt(1), n, threshold)
+	if _, err := Refresh(share[0], 1, []*big.Int{badShares[0]}, [][]*bn256.G1{badCommits}, threshold); err == nil {
+		t.Fatal("Refresh accepted a sharing of 1")
+	}
+
+	//Holders 1, 3, 5 reshare to 7 holders with threshold 4
+	newN, newT := 7, 4
+	subShares := make([][]*big.Int, len(I))
+	subCommits := make([][]*bn256.G1, len(I))
+	for k, i := range I {
+		subShares[k], subCommits[k], err = ShareFeldman(refreshed[i.Int64()-1], newN, newT)
+		if err != nil {
+			t.Fatalf("ShareFeldman failed: %v", err)
+		}
+		if !VerifyReshare(newCommits, int(i.Int64()), subCommits[k], newT) {
+			t.Fatalf("resharing of holder %v failed the check", i)
+		}
+	}
+	if VerifyReshare(newCommits, 2, subCommits[0], newT) {
+		t.Fatal("VerifyReshare accepted a dealing of another share")
+	}
+	reshared := make([]*big.Int, newN)
+	for j := range reshared {
+		received := make([]*big.Int, len(I))
+		for k := range received {
+			received[k] = subShares[k][j]
+		}
+		reshared[j], err = CombineReshares(I, j+1, received, subCommits)
+		if err != nil {
+			t.Fatalf("CombineReshares failed: %v", err)
+		}
+	}
+	resharedCommits, err := ReshareCommits(I, subCommits)
+	if err != nil {
+		t.Fatalf("ReshareCommits failed: %v", err)
+	}
+	if gs, _ := CommitmentAt(resharedCommits, big.NewInt(0)); !Operation.G1Equal(gs, new(bn256.G1).ScalarBaseMult(s)) {
+		t.Fatal("reshared commitments are not of the secret")
+	}
+	J := []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(6), big.NewInt(7)}
+	secret, _ = Recon([]*big.Int{reshared[1], reshared[2], reshared[5], reshared[6]}, J, newT)
+	if s.Cmp(secret) != 0 {
+		t.Fatal("reshared shares do not reconstruct the secret")
+	}
+	for j := range reshared {
+		if !VerifyFeldman(reshared[j], j+1, resharedCommits) {
+			t.Fatalf("reshared share %d failed the Feldman check", j+1)
+		}
+	}
+}
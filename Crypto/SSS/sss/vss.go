@@ -0,0 +1,139 @@
+package sss
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+)
+
+// Verifiable secret sharing on top of Share. For the polynomial
+// f(x) = a0 + a1·x + ... + a_{t-1}·x^{t-1} with a0 = s the dealer publishes
+//
+//	Feldman:  Ck = g1^{ak}
+//	Pedersen: Ck = g1^{ak}·h^{bk} for a second polynomial b and PedersenH h
+//
+// and holder i checks its share against ∏Ck^{i^k}. Feldman reveals g1^s,
+// Pedersen hides s unconditionally.
+
+// PedersenH is the second generator of Pedersen commitments. It is hashed, so
+// its discrete log to g1 is unknown.
+func PedersenH() *bn256.G1 {
+	h, err := bn256.HashG1("sss:pedersen:h")
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// ShareFeldman shares s like Share and returns the Feldman commitments of
+// the polynomial.
+func ShareFeldman(s *big.Int, n, t int) ([]*big.Int, []*bn256.G1, error) {
+	shares, coefficients, err := sharePoly(s, n, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	commits := make([]*bn256.G1, t)
+	for k, a := range coefficients {
+		commits[k] = new(bn256.G1).ScalarBaseMult(a)
+	}
+	return shares, commits, nil
+}
+
+// VerifyFeldman checks the share of holder i (1-based) against commits.
+func VerifyFeldman(share *big.Int, i int, commits []*bn256.G1) bool {
+	expected, err := CommitmentAt(commits, big.NewInt(int64(i)))
+	if err != nil || share == nil {
+		return false
+	}
+	return Operation.G1Equal(new(bn256.G1).ScalarBaseMult(new(big.Int).Mod(share, bn256.Order)), expected)
+}
+
+// SharePedersen shares s like Share and returns the blinding shares and the
+// Pedersen commitments of the polynomial.
+func SharePedersen(s *big.Int, n, t int) ([]*big.Int, []*big.Int, []*bn256.G1, error) {
+	shares, coefficients, err := sharePoly(s, n, t)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	blinds, blindCoefficients, err := sharePoly(randomScalar(), n, t)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h := PedersenH()
+	commits := make([]*bn256.G1, t)
+	for k := range coefficients {
+		commits[k] = new(bn256.G1).Add(new(bn256.G1).ScalarBaseMult(coefficients[k]), new(bn256.G1).ScalarMult(h, blindCoefficients[k]))
+	}
+	return shares, blinds, commits, nil
+}
+
+// VerifyPedersen checks the share and blinding share of holder i (1-based)
+// against commits.
+func VerifyPedersen(share, blind *big.Int, i int, commits []*bn256.G1) bool {
+	expected, err := CommitmentAt(commits, big.NewInt(int64(i)))
+	if err != nil || share == nil || blind == nil {
+		return false
+	}
+	got := new(bn256.G1).Add(new(bn256.G1).ScalarBaseMult(new(big.Int).Mod(share, bn256.Order)), new(bn256.G1).ScalarMult(PedersenH(), new(big.Int).Mod(blind, bn256.Order)))
+	return Operation.G1Equal(got, expected)
+}
+
+// CommitmentAt evaluates committed coefficients at x in the exponent:
+// ∏Ck^{x^k}. For Feldman commitments this is g1^{f(x)}.
+func CommitmentAt(commits []*bn256.G1, x *big.Int) (*bn256.G1, error) {
+	if len(commits) == 0 {
+		return nil, errors.New("no commitments")
+	}
+	sum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	xPower := big.NewInt(1)
+	for k, c := range commits {
+		if c == nil {
+			return nil, fmt.Errorf("commitment %d is missing", k)
+		}
+		sum.Add(sum, new(bn256.G1).ScalarMult(c, xPower))
+		xPower = new(big.Int).Mul(xPower, x)
+		xPower.Mod(xPower, bn256.Order)
+	}
+	return sum, nil
+}
+
+// ReconG1 reconstructs g^s from the shares g^{f(i)} of the holders I.
+func ReconG1(shares []*bn256.G1, I []*big.Int) (*bn256.G1, error) {
+	if len(shares) != len(I) {
+		return nil, fmt.Errorf("got %d shares for %d holders", len(shares), len(I))
+	}
+	lambdas, err := PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, err
+	}
+	secret := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for i, share := range shares {
+		secret.Add(secret, new(bn256.G1).ScalarMult(share, lambdas[i]))
+	}
+	return secret, nil
+}
+
+// ReconGT reconstructs e^s from the shares e^{f(i)} of the holders I.
+func ReconGT(shares []*bn256.GT, I []*big.Int) (*bn256.GT, error) {
+	if len(shares) != len(I) {
+		return nil, fmt.Errorf("got %d shares for %d holders", len(shares), len(I))
+	}
+	lambdas, err := PrecomputeLagrangeCoefficients(I)
+	if err != nil {
+		return nil, err
+	}
+	secret := new(bn256.GT).ScalarBaseMult(big.NewInt(0))
+	for i, share := range shares {
+		secret.Add(secret, new(bn256.GT).ScalarMult(share, lambdas[i]))
+	}
+	return secret, nil
+}
+
+func randomScalar() *big.Int {
+	x, _ := rand.Int(rand.Reader, bn256.Order)
+	return x
+}
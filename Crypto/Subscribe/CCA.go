@@ -0,0 +1,81 @@
+package Sub
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/WXY1313/Trade/Crypto/Operation"
+	"github.com/fentec-project/bn256"
+)
+
+// CCA mode, as CPABE.EncryptCCA: beta is taken from a random oracle on
+// (M, Com, Epoch, Revoked) and DecryptCCA checks every component of the
+// ciphertext against it.
+
+// EncryptCCA encrypts m for epoch in CCA mode.
+func EncryptCCA(spk *SPK, m *big.Int, epoch uint64) (*SubCiphertext, error) {
+	return encrypt(spk, m, epoch, true)
+}
+
+// DecryptCCA decrypts a ciphertext of EncryptCCA and rejects it if it was
+// tampered with.
+func DecryptCCA(spk *SPK, ct *SubCiphertext, subkey *SubKey, sk *big.Int) (*bn256.GT, error) {
+	M, err := Decrypt(spk, ct, subkey, sk)
+	if err != nil {
+		return nil, err
+	}
+	if !reencrypts(spk, ct, M) {
+		return nil, fmt.Errorf("subscription ciphertext failed the re-encryption check")
+	}
+	return M, nil
+}
+
+// reencrypts tells whether ct is the CCA encryption of M.
+func reencrypts(spk *SPK, ct *SubCiphertext, M *bn256.GT) bool {
+	if ct.Com == nil || ct.C1 == nil || len(ct.E) != spk.EpochBits+1 || checkRevoked(spk.UserBits, ct.Revoked) != nil {
+		return false
+	}
+	beta := foBeta(M, ct.Com, ct.Epoch, ct.Revoked)
+	if !Operation.G2Equal(ct.C2, new(bn256.G2).ScalarMult(spk.G2, beta)) {
+		return false
+	}
+	//C1/g1^{γ*beta} = h1^m with g1^m = Com and e(h1^m,u2) = M
+	hm := new(bn256.G1).Add(ct.C1, new(bn256.G1).Neg(new(bn256.G1).ScalarMult(spk.GammaG1, beta)))
+	if !GTEqual(bn256.Pair(hm, spk.U2), M) || !GTEqual(bn256.Pair(hm, spk.G2), bn256.Pair(ct.Com, spk.H2)) {
+		return false
+	}
+	for l := range ct.E {
+		if !G1Equal(ct.E[l], new(bn256.G1).ScalarMult(EpochElement(l, ct.Epoch>>uint(spk.EpochBits-l)), beta)) {
+			return false
+		}
+	}
+	cover := subtreeCover(spk.UserBits, ct.Revoked)
+	if len(ct.V) != len(cover) {
+		return false
+	}
+	for _, node := range cover {
+		if !G1Equal(ct.V[nodeID(int(node[0]), node[1])], new(bn256.G1).ScalarMult(UserElement(int(node[0]), node[1]), beta)) {
+			return false
+		}
+	}
+	return true
+}
+
+// foBeta is the random oracle fixing beta of a CCA ciphertext.
+func foBeta(M *bn256.GT, com *bn256.G1, epoch uint64, revoked []uint64) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("Sub:fo"))
+	h.Write(M.Marshal())
+	h.Write(com.Marshal())
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], epoch)
+	h.Write(n[:])
+	for _, id := range revoked {
+		binary.BigEndian.PutUint64(n[:], id)
+		h.Write(n[:])
+	}
+	beta, _ := Operation.NewOracleSampler(h.Sum(nil)).Sample()
+	return beta
+}
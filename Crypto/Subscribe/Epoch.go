@@ -0,0 +1,58 @@
+package Sub
+
+import (
+	"fmt"
+
+	"github.com/fentec-project/bn256"
+)
+
+// DefaultEpochBits is the depth of the epoch tree used by Setup: 2^16 epochs,
+// i.e. more than 5000 years of monthly periods.
+const DefaultEpochBits = 16
+
+// Epochs are the leaves of a complete binary tree of depth EpochBits. A node
+// is identified by its level (0 is the root) and the prefix of the epochs
+// below it, so the ancestor of epoch e at level l is e >> (EpochBits-l).
+
+func nodeID(level int, prefix uint64) string {
+	return fmt.Sprintf("%d:%d", level, prefix)
+}
+
+// EpochElement is F(w), the G1 element hashed from the tree node w.
+func EpochElement(level int, prefix uint64) *bn256.G1 {
+	fw, err := bn256.HashG1("Sub:epoch:" + nodeID(level, prefix))
+	if err != nil {
+		panic(err)
+	}
+	return fw
+}
+
+// cover returns the smallest set of tree nodes whose leaves are exactly the
+// epochs in [start, end], as (level, prefix) pairs.
+func cover(bits int, start, end uint64) [][2]uint64 {
+	var nodes [][2]uint64
+	for start <= end {
+		// Climb while start stays the leftmost leaf of a subtree inside the range
+		level := bits
+		for level > 0 {
+			span := uint64(1) << uint(bits-level+1)
+			if start%span != 0 || start+span-1 > end {
+				break
+			}
+			level--
+		}
+		nodes = append(nodes, [2]uint64{uint64(level), start >> uint(bits-level)})
+		start += uint64(1) << uint(bits-level)
+	}
+	return nodes
+}
+
+func checkEpoch(bits int, epoch uint64) error {
+	if bits < 1 || bits > maxBits {
+		return fmt.Errorf("invalid epoch tree depth %d", bits)
+	}
+	if epoch >= uint64(1)<<uint(bits) {
+		return fmt.Errorf("epoch %d outside the epoch tree", epoch)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package Sub
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fentec-project/bn256"
+)
+
+// DefaultUserBits is the depth of the subscriber tree used by Setup, so a
+// seller can issue 2^16 subscription keys.
+const DefaultUserBits = 16
+
+// Every subscription key is a leaf of a second complete binary tree of depth
+// UserBits and holds a component for each node on its path to the root.
+// Ciphertexts carry a component for each node of the complete subtree cover
+// of the non-revoked leaves, so a revoked key finds none of its path nodes.
+
+// UserElement is G(v), the G1 element hashed from the subscriber tree node v.
+func UserElement(level int, prefix uint64) *bn256.G1 {
+	gv, err := bn256.HashG1("Sub:user:" + nodeID(level, prefix))
+	if err != nil {
+		panic(err)
+	}
+	return gv
+}
+
+// subtreeCover returns the roots of the maximal subtrees containing no
+// revoked leaf, as (level, prefix) pairs in a fixed order.
+func subtreeCover(bits int, revoked []uint64) [][2]uint64 {
+	if len(revoked) == 0 {
+		return [][2]uint64{{0, 0}}
+	}
+	// Mark the paths from the revoked leaves to the root
+	marked := make(map[[2]uint64]bool)
+	for _, id := range revoked {
+		for l := 0; l <= bits; l++ {
+			marked[[2]uint64{uint64(l), id >> uint(bits-l)}] = true
+		}
+	}
+	// The cover are the unmarked children of marked inner nodes
+	var nodes [][2]uint64
+	for node := range marked {
+		if int(node[0]) == bits {
+			continue
+		}
+		for _, child := range [][2]uint64{{node[0] + 1, 2 * node[1]}, {node[0] + 1, 2*node[1] + 1}} {
+			if !marked[child] {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i][0] != nodes[j][0] {
+			return nodes[i][0] < nodes[j][0]
+		}
+		return nodes[i][1] < nodes[j][1]
+	})
+	return nodes
+}
+
+// Revoke adds the subscription key with identifier id to the revocation list
+// of spk. Ciphertexts encrypted afterwards cannot be decrypted with that key;
+// every other key is unaffected.
+func Revoke(spk *SPK, id uint64) error {
+	if err := checkUser(spk.UserBits, id); err != nil {
+		return err
+	}
+	i := sort.Search(len(spk.Revoked), func(i int) bool { return spk.Revoked[i] >= id })
+	if i < len(spk.Revoked) && spk.Revoked[i] == id {
+		return nil
+	}
+	spk.Revoked = append(spk.Revoked, 0)
+	copy(spk.Revoked[i+1:], spk.Revoked[i:])
+	spk.Revoked[i] = id
+	return nil
+}
+
+func checkUser(bits int, id uint64) error {
+	if bits < 1 || bits > maxBits {
+		return fmt.Errorf("invalid subscriber tree depth %d", bits)
+	}
+	if id >= uint64(1)<<uint(bits) {
+		return fmt.Errorf("subscriber %d outside the subscriber tree", id)
+	}
+	return nil
+}
+
+// checkRevoked checks that a revocation list is strictly increasing and fits
+// in the subscriber tree.
+func checkRevoked(bits int, revoked []uint64) error {
+	for i, id := range revoked {
+		if err := checkUser(bits, id); err != nil {
+			return err
+		}
+		if i > 0 && revoked[i-1] >= id {
+			return fmt.Errorf("revocation list is not sorted")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package Sub
+
+import (
+	"fmt"
+
+	"github.com/WXY1313/Trade/Crypto/Codec"
+	"github.com/fentec-project/bn256"
+)
+
+// maxBits is the depth of the deepest epoch or subscriber tree. Keys and
+// ciphertexts are decoded without the SPK, so their decoders check them
+// against trees of this depth; KeyCheck, CipherCheck and Decrypt check them
+// against the depths of the SPK.
+const maxBits = 63
+
+// Marshal encodes the seller's subscription public key.
+func (spk *SPK) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeSubSPK)
+	e.G1(spk.G1)
+	e.G2(spk.G2)
+	e.G1(spk.U1)
+	e.G2(spk.U2)
+	e.G1(spk.H1)
+	e.G2(spk.H2)
+	e.G1(spk.GammaG1)
+	e.Uint32(spk.EpochBits)
+	e.Uint32(spk.UserBits)
+	putIDs(e, spk.Revoked)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a subscription public key produced by Marshal.
+func (spk *SPK) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeSubSPK)
+	out := &SPK{
+		G1:        d.G1(),
+		G2:        d.G2(),
+		U1:        d.G1(),
+		U2:        d.G2(),
+		H1:        d.G1(),
+		H2:        d.G2(),
+		GammaG1:   d.G1(),
+		EpochBits: d.Uint32(),
+		UserBits:  d.Uint32(),
+		Revoked:   getIDs(d),
+		Order:     bn256.Order,
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if err := checkEpoch(out.EpochBits, 0); err != nil {
+		return err
+	}
+	if err := checkRevoked(out.UserBits, out.Revoked); err != nil {
+		return err
+	}
+	*spk = *out
+	return nil
+}
+
+// Marshal encodes the subscription key.
+func (subkey *SubKey) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeSubKey)
+	e.Uint64(subkey.ID)
+	e.Uint64(subkey.Start)
+	e.Uint64(subkey.End)
+	e.G1Map(subkey.SK1)
+	e.G1(subkey.SK2)
+	e.G2Map(subkey.SK3)
+	e.G1Map(subkey.SK4)
+	e.G2Map(subkey.SK5)
+	e.G2(subkey.R)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a subscription key produced by Marshal. It checks the
+// structure of the key; KeyCheck checks it against the SPK.
+func (subkey *SubKey) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeSubKey)
+	out := &SubKey{
+		ID:    d.Uint64(),
+		Start: d.Uint64(),
+		End:   d.Uint64(),
+		SK1:   d.G1Map(),
+		SK2:   d.G1(),
+		SK3:   d.G2Map(),
+		SK4:   d.G1Map(),
+		SK5:   d.G2Map(),
+		R:     d.G2(),
+	}
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if out.Start > out.End {
+		return fmt.Errorf("subscription key starts at epoch %d after its end %d", out.Start, out.End)
+	}
+	if err := checkEpoch(maxBits, out.End); err != nil {
+		return err
+	}
+	if err := checkUser(maxBits, out.ID); err != nil {
+		return err
+	}
+	if err := samePairs(out.SK1, out.SK3); err != nil {
+		return fmt.Errorf("epoch part of the subscription key: %v", err)
+	}
+	if err := samePairs(out.SK4, out.SK5); err != nil {
+		return fmt.Errorf("revocation part of the subscription key: %v", err)
+	}
+	*subkey = *out
+	return nil
+}
+
+// Marshal encodes the subscription ciphertext. M is the encryptor's plaintext
+// and is never written.
+func (ct *SubCiphertext) Marshal() ([]byte, error) {
+	e := Codec.NewEncoder(Codec.TypeSubCiphertext)
+	e.G1(ct.Com)
+	e.G1(ct.C1)
+	e.G2(ct.C2)
+	e.Uint64(ct.Epoch)
+	e.Uint32(len(ct.E))
+	for _, el := range ct.E {
+		e.G1(el)
+	}
+	putIDs(e, ct.Revoked)
+	e.G1Map(ct.V)
+	return e.Bytes()
+}
+
+// Unmarshal decodes a subscription ciphertext produced by Marshal. It checks
+// the structure of the ciphertext; that len(E) is EpochBits+1 of the SPK is
+// left to CipherCheck and Decrypt.
+func (ct *SubCiphertext) Unmarshal(data []byte) error {
+	d := Codec.NewDecoder(data, Codec.TypeSubCiphertext)
+	out := &SubCiphertext{
+		Com:   d.G1(),
+		C1:    d.G1(),
+		C2:    d.G2(),
+		Epoch: d.Uint64(),
+	}
+	for n := d.Uint32(); n > 0 && d.Err() == nil; n-- {
+		out.E = append(out.E, d.G1())
+	}
+	out.Revoked = getIDs(d)
+	out.V = d.G1Map()
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	//E has one element per level of an epoch tree of depth len(E)-1
+	if len(out.E) < 2 || len(out.E) > maxBits+1 {
+		return fmt.Errorf("subscription ciphertext has %d epoch elements", len(out.E))
+	}
+	if err := checkEpoch(len(out.E)-1, out.Epoch); err != nil {
+		return err
+	}
+	if err := checkRevoked(maxBits, out.Revoked); err != nil {
+		return err
+	}
+	for id, v := range out.V {
+		if v == nil {
+			return fmt.Errorf("revocation cover node %s is missing", id)
+		}
+	}
+	*ct = *out
+	return nil
+}
+
+// samePairs checks that a and b hold elements for the same nodes.
+func samePairs(a map[string]*bn256.G1, b map[string]*bn256.G2) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d nodes in G1 and %d in G2", len(a), len(b))
+	}
+	for id, x := range a {
+		if x == nil || b[id] == nil {
+			return fmt.Errorf("node %s is incomplete", id)
+		}
+	}
+	return nil
+}
+
+// putIDs writes a revocation list.
+func putIDs(e *Codec.Encoder, ids []uint64) {
+	e.Uint32(len(ids))
+	for _, id := range ids {
+		e.Uint64(id)
+	}
+}
+
+func getIDs(d *Codec.Decoder) []uint64 {
+	var ids []uint64
+	for n := d.Uint32(); n > 0 && d.Err() == nil; n-- {
+		ids = append(ids, d.Uint64())
+	}
+	return ids
+}
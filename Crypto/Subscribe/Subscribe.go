@@ -2,6 +2,7 @@ package Sub
 
 import (
 	"bytes"
+	"fmt"
 	"math/big"
 
 	"github.com/WXY1313/Trade/Crypto/CPABE"
@@ -10,30 +11,49 @@ import (
 )
 
 type SPK struct {
-	G1      *bn256.G1
-	G2      *bn256.G2
-	U1      *bn256.G1
-	U2      *bn256.G2
-	H1      *bn256.G1
-	H2      *bn256.G2
-	GammaG1 *bn256.G1
-	Order   *big.Int
+	G1        *bn256.G1
+	G2        *bn256.G2
+	U1        *bn256.G1
+	U2        *bn256.G2
+	H1        *bn256.G1
+	H2        *bn256.G2
+	GammaG1   *bn256.G1
+	EpochBits int      // depth of the epoch tree, see Epoch.go
+	UserBits  int      // depth of the subscriber tree, see Revoke.go
+	Revoked   []uint64 // sorted identifiers of revoked subscription keys
+	Order     *big.Int
 }
 
 type SSK struct {
-	Gamma *big.Int
+	Gamma  *big.Int
+	NextID uint64 // identifier of the next subscription key
 }
 
+// SubKey is valid for the epochs [Start, End]. It holds one component per
+// node w of the cover of that range and one per node v on the path of its
+// leaf ID in the subscriber tree; γ is split between the two halves with a
+// per-key ρ.
 type SubKey struct {
-	SK1 *bn256.G1
-	SK2 *bn256.G1
+	ID    uint64
+	Start uint64
+	End   uint64
+	SK1   map[string]*bn256.G1 // SK1[w] = u1^{γ-ρ}·pk^t·F(w)^{tw}
+	SK2   *bn256.G1            // SK2 = g1^t
+	SK3   map[string]*bn256.G2 // SK3[w] = g2^{tw}
+	SK4   map[string]*bn256.G1 // SK4[v] = u1^ρ·G(v)^{sv}
+	SK5   map[string]*bn256.G2 // SK5[v] = g2^{sv}
+	R     *bn256.G2            // R = g2^ρ
 }
 
 type SubCiphertext struct {
-	M   *bn256.GT
-	Com *bn256.G1 // Com = g1^m
-	C1  *bn256.G1 //C=h1^m*g1^{alpha*beta}
-	C2  *bn256.G2 //_C=h2^{beta}
+	M       *bn256.GT
+	Com     *bn256.G1 // Com = g1^m
+	C1      *bn256.G1 //C=h1^m*g1^{alpha*beta}
+	C2      *bn256.G2 //_C=h2^{beta}
+	Epoch   uint64
+	E       []*bn256.G1          // E[l] = F(w_l)^beta for the ancestor w_l of Epoch at level l
+	Revoked []uint64             // the revocation list at encryption time
+	V       map[string]*bn256.G1 // V[v] = G(v)^beta for the subtree cover of the non-revoked keys
 }
 
 func G1Equal(a, b *bn256.G1) bool {
@@ -56,14 +76,16 @@ func Setup(MPK *CPABE.MPK) (*SPK, *SSK, error) {
 	gammaG1 := new(bn256.G1).ScalarBaseMult(gamma)
 
 	spk := &SPK{
-		G1:      MPK.G1,
-		G2:      MPK.G2,
-		U1:      MPK.U1,
-		U2:      MPK.U2,
-		H1:      MPK.H1,
-		H2:      MPK.H2,
-		GammaG1: gammaG1,
-		Order:   MPK.Order,
+		G1:        MPK.G1,
+		G2:        MPK.G2,
+		U1:        MPK.U1,
+		U2:        MPK.U2,
+		H1:        MPK.H1,
+		H2:        MPK.H2,
+		GammaG1:   gammaG1,
+		EpochBits: DefaultEpochBits,
+		UserBits:  DefaultUserBits,
+		Order:     MPK.Order,
 	}
 	ssk := &SSK{
 		Gamma: gamma,
@@ -72,48 +94,213 @@ func Setup(MPK *CPABE.MPK) (*SPK, *SSK, error) {
 	return spk, ssk, nil
 }
 
-func KeyGen(spk *SPK, ssk *SSK, pk *bn256.G1) (*SubKey, error) {
+// KeyGen issues a subscription key for the epochs start to end inclusive.
+// The key gets the next free identifier of ssk, which Revoke takes.
+func KeyGen(spk *SPK, ssk *SSK, pk *bn256.G1, start, end uint64) (*SubKey, error) {
+	if err := checkEpoch(spk.EpochBits, end); err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("empty epoch range [%d, %d]", start, end)
+	}
+	userID := ssk.NextID
+	if err := checkUser(spk.UserBits, userID); err != nil {
+		return nil, err
+	}
+	ssk.NextID++
 	//t←Zp,L=g^t
 	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
 	t, _ := sampler.Sample()
-	sk1 := new(bn256.G1).Add(new(bn256.G1).ScalarMult(spk.U1, ssk.Gamma), new(bn256.G1).ScalarMult(pk, t))
+	rho, _ := sampler.Sample()
+	sk4 := make(map[string]*bn256.G1)
+	sk5 := make(map[string]*bn256.G2)
+	u1Rho := new(bn256.G1).ScalarMult(spk.U1, rho)
+	for l := 0; l <= spk.UserBits; l++ {
+		sv, _ := sampler.Sample()
+		prefix := userID >> uint(spk.UserBits-l)
+		sk4[nodeID(l, prefix)] = new(bn256.G1).Add(u1Rho, new(bn256.G1).ScalarMult(UserElement(l, prefix), sv))
+		sk5[nodeID(l, prefix)] = new(bn256.G2).ScalarMult(spk.G2, sv)
+	}
+	gammaRho := new(big.Int).Sub(ssk.Gamma, rho)
+	gammaRho.Mod(gammaRho, spk.Order)
+	base := new(bn256.G1).Add(new(bn256.G1).ScalarMult(spk.U1, gammaRho), new(bn256.G1).ScalarMult(pk, t))
 	sk2 := new(bn256.G1).ScalarMult(spk.G1, t) //L=g^t
-	return &SubKey{SK1: sk1, SK2: sk2}, nil
+	sk1 := make(map[string]*bn256.G1)
+	sk3 := make(map[string]*bn256.G2)
+	for _, w := range cover(spk.EpochBits, start, end) {
+		tw, _ := sampler.Sample()
+		id := nodeID(int(w[0]), w[1])
+		sk1[id] = new(bn256.G1).Add(base, new(bn256.G1).ScalarMult(EpochElement(int(w[0]), w[1]), tw))
+		sk3[id] = new(bn256.G2).ScalarMult(spk.G2, tw)
+	}
+	return &SubKey{ID: userID,
+		Start: start,
+		End:   end,
+		SK1:   sk1,
+		SK2:   sk2,
+		SK3:   sk3,
+		SK4:   sk4,
+		SK5:   sk5,
+		R:     new(bn256.G2).ScalarMult(spk.G2, rho)}, nil
 }
 
 func KeyCheck(spk *SPK, subkey *SubKey, vk *bn256.G2) bool {
-	if GTEqual(bn256.Pair(subkey.SK1, spk.G2), new(bn256.GT).Add(bn256.Pair(spk.GammaG1, spk.U2), bn256.Pair(subkey.SK2, vk))) {
-		return true
+	if subkey.Start > subkey.End || checkEpoch(spk.EpochBits, subkey.End) != nil {
+		return false
+	}
+	if checkUser(spk.UserBits, subkey.ID) != nil || subkey.R == nil {
+		return false
+	}
+	nodes := cover(spk.EpochBits, subkey.Start, subkey.End)
+	if len(subkey.SK1) != len(nodes) || len(subkey.SK3) != len(nodes) {
+		return false
+	}
+	if len(subkey.SK4) != spk.UserBits+1 || len(subkey.SK5) != spk.UserBits+1 {
+		return false
+	}
+	//e(u1^ρ, g2) = e(u1, R)
+	u1Rho := bn256.Pair(spk.U1, subkey.R)
+	for l := 0; l <= spk.UserBits; l++ {
+		prefix := subkey.ID >> uint(spk.UserBits-l)
+		sk4, sk5 := subkey.SK4[nodeID(l, prefix)], subkey.SK5[nodeID(l, prefix)]
+		if sk4 == nil || sk5 == nil {
+			return false
+		}
+		right := new(bn256.GT).Add(u1Rho, bn256.Pair(UserElement(l, prefix), sk5))
+		if !GTEqual(bn256.Pair(sk4, spk.G2), right) {
+			return false
+		}
+	}
+	base := new(bn256.GT).Add(bn256.Pair(spk.GammaG1, spk.U2), new(bn256.GT).Neg(u1Rho))
+	base.Add(base, bn256.Pair(subkey.SK2, vk))
+	for _, w := range nodes {
+		id := nodeID(int(w[0]), w[1])
+		sk1, sk3 := subkey.SK1[id], subkey.SK3[id]
+		if sk1 == nil || sk3 == nil {
+			return false
+		}
+		right := new(bn256.GT).Add(base, bn256.Pair(EpochElement(int(w[0]), w[1]), sk3))
+		if !GTEqual(bn256.Pair(sk1, spk.G2), right) {
+			return false
+		}
 	}
-	return false
+	return true
 }
 
-func Encrypt(spk *SPK, m *big.Int) (*SubCiphertext, error) {
+// Encrypt encrypts m for the subscribers holding a key for epoch that are not
+// on the revocation list of spk.
+func Encrypt(spk *SPK, m *big.Int, epoch uint64) (*SubCiphertext, error) {
+	return encrypt(spk, m, epoch, false)
+}
+
+// encrypt draws beta at random or, in CCA mode, from foBeta.
+func encrypt(spk *SPK, m *big.Int, epoch uint64, cca bool) (*SubCiphertext, error) {
+	if err := checkEpoch(spk.EpochBits, epoch); err != nil {
+		return nil, err
+	}
+	if err := checkRevoked(spk.UserBits, spk.Revoked); err != nil {
+		return nil, err
+	}
 	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
 	com := new(bn256.G1).ScalarBaseMult(m)
 	mes := new(bn256.GT).ScalarMult(bn256.Pair(spk.H1, spk.U2), m)
 	beta, _ := sampler.Sample()
+	if cca {
+		beta = foBeta(mes, com, epoch, spk.Revoked)
+	}
 	c1 := new(bn256.G1).Add(new(bn256.G1).ScalarMult(spk.H1, m), new(bn256.G1).ScalarMult(spk.GammaG1, beta))
 	c2 := new(bn256.G2).ScalarMult(spk.G2, beta)
+	e := make([]*bn256.G1, spk.EpochBits+1)
+	for l := range e {
+		e[l] = new(bn256.G1).ScalarMult(EpochElement(l, epoch>>uint(spk.EpochBits-l)), beta)
+	}
+	v := make(map[string]*bn256.G1)
+	for _, node := range subtreeCover(spk.UserBits, spk.Revoked) {
+		v[nodeID(int(node[0]), node[1])] = new(bn256.G1).ScalarMult(UserElement(int(node[0]), node[1]), beta)
+	}
 
 	return &SubCiphertext{
-		M:   mes,
-		Com: com,
-		C1:  c1,
-		C2:  c2,
+		M:       mes,
+		Com:     com,
+		C1:      c1,
+		C2:      c2,
+		Epoch:   epoch,
+		E:       e,
+		Revoked: append([]uint64{}, spk.Revoked...),
+		V:       v,
 	}, nil
 }
 
 func CipherCheck(spk *SPK, ct *SubCiphertext) bool {
-	if GTEqual(bn256.Pair(ct.C1, spk.G2), new(bn256.GT).Add(bn256.Pair(ct.Com, spk.H2), bn256.Pair(spk.GammaG1, ct.C2))) {
-		return true
+	if checkEpoch(spk.EpochBits, ct.Epoch) != nil || len(ct.E) != spk.EpochBits+1 {
+		return false
 	}
-	return false
+	if checkRevoked(spk.UserBits, ct.Revoked) != nil {
+		return false
+	}
+	nodes := subtreeCover(spk.UserBits, ct.Revoked)
+	if len(ct.V) != len(nodes) {
+		return false
+	}
+	if !GTEqual(bn256.Pair(ct.C1, spk.G2), new(bn256.GT).Add(bn256.Pair(ct.Com, spk.H2), bn256.Pair(spk.GammaG1, ct.C2))) {
+		return false
+	}
+	//E[l] = F(w_l)^beta and V[v] = G(v)^beta for all l and v, checked at once
+	//with a random combination: e(∏E[l]^rl·∏V[v]^rv, g2) = e(∏F(w_l)^rl·∏G(v)^rv, C2)
+	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
+	sumE := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	sumF := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for l, el := range ct.E {
+		if el == nil {
+			return false
+		}
+		r, _ := sampler.Sample()
+		sumE.Add(sumE, new(bn256.G1).ScalarMult(el, r))
+		sumF.Add(sumF, new(bn256.G1).ScalarMult(EpochElement(l, ct.Epoch>>uint(spk.EpochBits-l)), r))
+	}
+	for _, node := range nodes {
+		vv := ct.V[nodeID(int(node[0]), node[1])]
+		if vv == nil {
+			return false
+		}
+		r, _ := sampler.Sample()
+		sumE.Add(sumE, new(bn256.G1).ScalarMult(vv, r))
+		sumF.Add(sumF, new(bn256.G1).ScalarMult(UserElement(int(node[0]), node[1]), r))
+	}
+	return GTEqual(bn256.Pair(sumE, spk.G2), bn256.Pair(sumF, ct.C2))
 }
 
+// Decrypt fails unless the epoch of ct lies in the range of subkey and subkey
+// was not revoked when ct was created.
 func Decrypt(spk *SPK, ct *SubCiphertext, subkey *SubKey, sk *big.Int) (*bn256.GT, error) {
-	denominator := bn256.Pair(new(bn256.G1).Add(subkey.SK1, new(bn256.G1).Neg(new(bn256.G1).ScalarMult(subkey.SK2, sk))), ct.C2)
-	numerator := bn256.Pair(ct.C1, spk.U2)
-	M := new(bn256.GT).Add(numerator, new(bn256.GT).Neg(denominator))
-	return M, nil
+	if len(ct.E) != spk.EpochBits+1 {
+		return nil, fmt.Errorf("malformed subscription ciphertext")
+	}
+	//Find the cover node of the ciphertext on the path of the key
+	var revPart *bn256.GT
+	for l := 0; l <= spk.UserBits && revPart == nil; l++ {
+		id := nodeID(l, subkey.ID>>uint(spk.UserBits-l))
+		vv, sk4, sk5 := ct.V[id], subkey.SK4[id], subkey.SK5[id]
+		if vv == nil || sk4 == nil || sk5 == nil {
+			continue
+		}
+		//e(u1^ρ, g2^beta) = e(SK4[v], C2)/e(V[v], SK5[v])
+		revPart = new(bn256.GT).Add(bn256.Pair(sk4, ct.C2), new(bn256.GT).Neg(bn256.Pair(vv, sk5)))
+	}
+	if revPart == nil {
+		return nil, fmt.Errorf("subscription key %d is revoked", subkey.ID)
+	}
+	//Find the cover node of the key above the ciphertext's epoch
+	for l := 0; l <= spk.EpochBits; l++ {
+		id := nodeID(l, ct.Epoch>>uint(spk.EpochBits-l))
+		sk1, sk3 := subkey.SK1[id], subkey.SK3[id]
+		if sk1 == nil || sk3 == nil {
+			continue
+		}
+		denominator := bn256.Pair(new(bn256.G1).Add(sk1, new(bn256.G1).Neg(new(bn256.G1).ScalarMult(subkey.SK2, sk))), ct.C2)
+		numerator := new(bn256.GT).Add(bn256.Pair(ct.C1, spk.U2), bn256.Pair(ct.E[l], sk3))
+		M := new(bn256.GT).Add(numerator, new(bn256.GT).Neg(denominator))
+		return M.Add(M, new(bn256.GT).Neg(revPart)), nil
+	}
+	return nil, fmt.Errorf("subscription key for epochs [%d, %d] does not cover epoch %d", subkey.Start, subkey.End, ct.Epoch)
 }
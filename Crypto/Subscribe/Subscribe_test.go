@@ -23,7 +23,7 @@ func TestAll(t *testing.T) {
 	vk := new(bn256.G2).ScalarMult(spk.G2, sk)
 
 	//KeyGen
-	subkey, err := KeyGen(spk, ssk, pk)
+	subkey, err := KeyGen(spk, ssk, pk, 0, 11)
 	require.NoError(t, err)
 	require.NotNil(t, subkey)
 
@@ -33,7 +33,7 @@ func TestAll(t *testing.T) {
 
 	//Encrypt
 	m, _ := sampler.Sample()
-	ct, err := Encrypt(spk, m)
+	ct, err := Encrypt(spk, m, 5)
 	if err != nil {
 		t.Errorf("fail to generate subscribe ciphertext")
 		return
@@ -47,8 +47,203 @@ func TestAll(t *testing.T) {
 
 	//Decrypt
 	recoverM, err := Decrypt(spk, ct, subkey, sk)
+	require.NoError(t, err)
 	if !GTEqual(ct.M, recoverM) {
 		t.Fatalf("decryption failed: M mismatch\noriginal: %v\nrecovered: %v",
 			ct.M, recoverM)
 	}
 }
+
+func TestSerialize(t *testing.T) {
+	mpk, _, _ := CPABE.Setup()
+	spk, ssk, err := Setup(mpk)
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
+	sk, _ := sampler.Sample()
+	pk := new(bn256.G1).ScalarMult(spk.G1, sk)
+	subkey, err := KeyGen(spk, ssk, pk, 0, 11)
+	require.NoError(t, err)
+	m, _ := sampler.Sample()
+	ct, err := Encrypt(spk, m, 5)
+	require.NoError(t, err)
+
+	enc, err := spk.Marshal()
+	require.NoError(t, err)
+	spk2 := new(SPK)
+	require.NoError(t, spk2.Unmarshal(enc))
+	enc, err = subkey.Marshal()
+	require.NoError(t, err)
+	subkey2 := new(SubKey)
+	require.NoError(t, subkey2.Unmarshal(enc))
+	enc, err = ct.Marshal()
+	require.NoError(t, err)
+	ct2 := new(SubCiphertext)
+	require.NoError(t, ct2.Unmarshal(enc))
+	require.Nil(t, ct2.M)
+	require.True(t, CipherCheck(spk2, ct2))
+	recoverM, err := Decrypt(spk2, ct2, subkey2, sk)
+	require.NoError(t, err)
+	require.True(t, GTEqual(ct.M, recoverM))
+
+	//Objects of a different type are rejected
+	require.Error(t, new(SubKey).Unmarshal(enc))
+
+	//Malformed keys and ciphertexts are rejected when decoded
+	dropOne := func(m map[string]*bn256.G2) map[string]*bn256.G2 {
+		out := make(map[string]*bn256.G2)
+		for id, x := range m {
+			out[id] = x
+		}
+		for id := range out {
+			delete(out, id)
+			break
+		}
+		return out
+	}
+	for _, bad := range []func(k *SubKey){
+		func(k *SubKey) { k.Start = k.End + 1 },
+		func(k *SubKey) { k.SK3 = dropOne(k.SK3) },
+		func(k *SubKey) { k.SK5 = dropOne(k.SK5) },
+	} {
+		k := *subkey
+		bad(&k)
+		enc, err := k.Marshal()
+		require.NoError(t, err)
+		require.Error(t, new(SubKey).Unmarshal(enc))
+	}
+	for _, bad := range []func(c *SubCiphertext){
+		func(c *SubCiphertext) { c.E = c.E[:1] },
+		func(c *SubCiphertext) { c.Epoch = uint64(1) << uint(len(c.E)-1) },
+		func(c *SubCiphertext) { c.Revoked = []uint64{3, 1} },
+	} {
+		c := *ct
+		bad(&c)
+		enc, err := c.Marshal()
+		require.NoError(t, err)
+		require.Error(t, new(SubCiphertext).Unmarshal(enc))
+	}
+}
+
+func TestEpochs(t *testing.T) {
+	//[3, 14] in a depth 4 tree is covered by 3, [4,7], [8,11], [12,13] and 14
+	require.Equal(t, [][2]uint64{{4, 3}, {2, 1}, {2, 2}, {3, 6}, {4, 14}}, cover(4, 3, 14))
+	require.Equal(t, [][2]uint64{{0, 0}}, cover(4, 0, 15))
+
+	mpk, _, _ := CPABE.Setup()
+	spk, ssk, err := Setup(mpk)
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
+	sk, _ := sampler.Sample()
+	pk := new(bn256.G1).ScalarMult(spk.G1, sk)
+	vk := new(bn256.G2).ScalarMult(spk.G2, sk)
+
+	//A yearly subscription for the months 24 to 35
+	subkey, err := KeyGen(spk, ssk, pk, 24, 35)
+	require.NoError(t, err)
+	require.True(t, KeyCheck(spk, subkey, vk))
+	for _, epoch := range []uint64{23, 24, 30, 35, 36, 1 << 15} {
+		m, _ := sampler.Sample()
+		ct, err := Encrypt(spk, m, epoch)
+		require.NoError(t, err)
+		require.True(t, CipherCheck(spk, ct))
+		recoverM, err := Decrypt(spk, ct, subkey, sk)
+		if epoch >= 24 && epoch <= 35 {
+			require.NoError(t, err)
+			require.True(t, GTEqual(ct.M, recoverM))
+		} else {
+			require.Error(t, err)
+		}
+	}
+
+	//Relabelling a ciphertext with another epoch is caught by CipherCheck and
+	//does not decrypt
+	m, _ := sampler.Sample()
+	ct, err := Encrypt(spk, m, 40)
+	require.NoError(t, err)
+	ct.Epoch = 30
+	require.False(t, CipherCheck(spk, ct))
+	recoverM, err := Decrypt(spk, ct, subkey, sk)
+	require.False(t, err == nil && GTEqual(ct.M, recoverM))
+
+	_, err = KeyGen(spk, ssk, pk, 10, 9)
+	require.Error(t, err)
+	_, err = Encrypt(spk, m, 1<<DefaultEpochBits)
+	require.Error(t, err)
+}
+
+func TestRevocation(t *testing.T) {
+	//Revoking leaf 5 of a depth 3 tree leaves 0-3, 6-7 and 4 as the cover
+	require.Equal(t, [][2]uint64{{1, 0}, {2, 3}, {3, 4}}, subtreeCover(3, []uint64{5}))
+	require.Equal(t, [][2]uint64{{0, 0}}, subtreeCover(3, nil))
+
+	mpk, _, _ := CPABE.Setup()
+	spk, ssk, err := Setup(mpk)
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
+	sks := make([]*big.Int, 4)
+	subkeys := make([]*SubKey, 4)
+	for i := range subkeys {
+		sks[i], _ = sampler.Sample()
+		pk := new(bn256.G1).ScalarMult(spk.G1, sks[i])
+		vk := new(bn256.G2).ScalarMult(spk.G2, sks[i])
+		subkeys[i], err = KeyGen(spk, ssk, pk, 0, 11)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), subkeys[i].ID)
+		require.True(t, KeyCheck(spk, subkeys[i], vk))
+	}
+
+	//Ciphertexts created before the revocation still decrypt
+	m, _ := sampler.Sample()
+	old, err := Encrypt(spk, m, 5)
+	require.NoError(t, err)
+	require.NoError(t, Revoke(spk, subkeys[2].ID))
+	require.NoError(t, Revoke(spk, subkeys[2].ID))
+	require.Equal(t, []uint64{2}, spk.Revoked)
+
+	ct, err := Encrypt(spk, m, 5)
+	require.NoError(t, err)
+	require.True(t, CipherCheck(spk, ct))
+	for i, subkey := range subkeys {
+		recoverM, err := Decrypt(spk, old, subkey, sks[i])
+		require.NoError(t, err)
+		require.True(t, GTEqual(old.M, recoverM))
+		recoverM, err = Decrypt(spk, ct, subkey, sks[i])
+		if i == 2 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.True(t, GTEqual(ct.M, recoverM))
+		}
+	}
+
+	//Dropping an identifier from the list is caught by CipherCheck
+	ct.Revoked = nil
+	require.False(t, CipherCheck(spk, ct))
+	require.Error(t, Revoke(spk, 1<<DefaultUserBits))
+}
+
+func TestCCA(t *testing.T) {
+	mpk, _, _ := CPABE.Setup()
+	spk, ssk, err := Setup(mpk)
+	require.NoError(t, err)
+	sampler := sample.NewUniformRange(big.NewInt(1), spk.Order)
+	sk, _ := sampler.Sample()
+	subkey, err := KeyGen(spk, ssk, new(bn256.G1).ScalarMult(spk.G1, sk), 0, 11)
+	require.NoError(t, err)
+	m, _ := sampler.Sample()
+	ct, err := EncryptCCA(spk, m, 5)
+	require.NoError(t, err)
+	require.True(t, CipherCheck(spk, ct))
+	recoverM, err := DecryptCCA(spk, ct, subkey, sk)
+	require.NoError(t, err)
+	require.True(t, GTEqual(ct.M, recoverM))
+
+	mauled := *ct
+	mauled.C1 = new(bn256.G1).Add(ct.C1, spk.H1)
+	_, err = DecryptCCA(spk, &mauled, subkey, sk)
+	require.Error(t, err)
+	plain, err := Encrypt(spk, m, 5)
+	require.NoError(t, err)
+	_, err = DecryptCCA(spk, plain, subkey, sk)
+	require.Error(t, err)
+}
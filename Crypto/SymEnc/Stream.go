@@ -0,0 +1,204 @@
+package SymEnc
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fentec-project/bn256"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ChunkSize is the plaintext size of every chunk of a stream except the last.
+const ChunkSize = 64 * 1024
+
+// saltSize is the length of the per-stream salt in the stream header.
+const saltSize = 32
+
+// A stream is suite || salt followed by the sealed chunks. Each chunk is
+// ChunkSize bytes of plaintext (the last one may be shorter, even empty)
+// sealed under a per-stream key with nonce = index || 0...0 || final, so a
+// chunk only opens at its own position and truncating the stream at a chunk
+// boundary is detected.
+
+func streamAEAD(gt *bn256.GT, suite Suite, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, KeySize)
+	r := hkdf.New(sha256.New, gt.Marshal(), salt, []byte(fmt.Sprintf("SymEnc:stream:%d", suite)))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+	return newAEAD(suite, key)
+}
+
+func chunkNonce(size int, index uint64, final bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce, index)
+	if final {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	ad     []byte
+	buf    []byte
+	out    []byte
+	index  uint64
+	err    error
+	closed bool
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it
+// into w in chunks keyed from gt, with ad bound into every chunk. Close must be
+// called to write the final chunk; it does not close w.
+func NewEncryptWriter(w io.Writer, gt *bn256.GT, suite Suite, ad []byte) (io.WriteCloser, error) {
+	header := make([]byte, 1+saltSize)
+	header[0] = byte(suite)
+	if _, err := rand.Read(header[1:]); err != nil {
+		return nil, err
+	}
+	aead, err := streamAEAD(gt, suite, header[1:])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:    w,
+		aead: aead,
+		ad:   append([]byte{}, ad...),
+		buf:  make([]byte, 0, ChunkSize),
+		out:  make([]byte, 0, ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (ew *encryptWriter) flush(final bool) error {
+	ew.out = ew.aead.Seal(ew.out[:0], chunkNonce(ew.aead.NonceSize(), ew.index, final), ew.buf, ew.ad)
+	ew.index++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(ew.out)
+	return err
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("symenc: write to closed stream")
+	}
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, since the last
+		// chunk has to carry the final flag
+		if len(ew.buf) == ChunkSize {
+			if ew.err = ew.flush(false); ew.err != nil {
+				return n, ew.err
+			}
+		}
+		k := copy(ew.buf[len(ew.buf):ChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close seals the buffered data as the final chunk.
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	if ew.err != nil {
+		return ew.err
+	}
+	return ew.flush(true)
+}
+
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	ad    []byte
+	in    []byte
+	plain []byte
+	index uint64
+	done  bool
+	err   error
+}
+
+// NewDecryptReader returns a reader of the plaintext of a stream written by
+// NewEncryptWriter. Data is only returned after its chunk is authenticated, and
+// a stream that was reordered, truncated or extended fails with an error
+// instead of io.EOF.
+func NewDecryptReader(r io.Reader, gt *bn256.GT, ad []byte) (io.Reader, error) {
+	header := make([]byte, 1+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.New("symenc: truncated stream header")
+	}
+	aead, err := streamAEAD(gt, Suite(header[0]), header[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:    bufio.NewReader(r),
+		aead: aead,
+		ad:   append([]byte{}, ad...),
+		in:   make([]byte, ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (dr *decryptReader) next() error {
+	n, err := io.ReadFull(dr.r, dr.in)
+	final := false
+	switch err {
+	case nil:
+		// A full chunk is final exactly when nothing follows it
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		return errors.New("symenc: truncated stream")
+	default:
+		return err
+	}
+	nonce := chunkNonce(dr.aead.NonceSize(), dr.index, final)
+	plain, err := dr.aead.Open(dr.in[:0], nonce, dr.in[:n], dr.ad)
+	if err != nil {
+		return errors.New("symenc: chunk authentication failed")
+	}
+	dr.plain = plain
+	dr.index++
+	dr.done = final
+	return nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			dr.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
@@ -1,14 +1,106 @@
 package SymEnc
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
+	"errors"
+	"io"
 
 	"github.com/fentec-project/bn256"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/pbkdf2"
 )
 
+// Suite selects the AEAD used by Seal. It is the first byte of every sealed
+// payload so Open does not need to be told which one was used.
+type Suite byte
+
+const (
+	AES256GCM        Suite = 0x01
+	ChaCha20Poly1305 Suite = 0x02
+)
+
+// KeySize is the length of the keys returned by DeriveKey.
+const KeySize = 32
+
+// DeriveKey derives a KeySize-byte key from gt with HKDF-SHA256 over the
+// canonical marshalling of gt. The info string separates keys for different
+// uses of the same group element.
+func DeriveKey(gt *bn256.GT, info string) []byte {
+	key := make([]byte, KeySize)
+	r := hkdf.New(sha256.New, gt.Marshal(), nil, []byte("SymEnc:"+info))
+	if _, err := io.ReadFull(r, key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func (suite Suite) aead(gt *bn256.GT) (cipher.AEAD, error) {
+	switch suite {
+	case AES256GCM:
+		return newAEAD(suite, DeriveKey(gt, "aes-256-gcm"))
+	case ChaCha20Poly1305:
+		return newAEAD(suite, DeriveKey(gt, "chacha20-poly1305"))
+	}
+	return nil, errors.New("symenc: unknown suite")
+}
+
+func newAEAD(suite Suite, key []byte) (cipher.AEAD, error) {
+	switch suite {
+	case AES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, errors.New("symenc: unknown suite")
+}
+
+// Seal encrypts and authenticates plaintext under a key derived from gt, and
+// authenticates ad without encrypting it. The output is
+// suite || nonce || ciphertext || tag with a fresh random nonce.
+func Seal(gt *bn256.GT, suite Suite, plaintext, ad []byte) ([]byte, error) {
+	aead, err := suite.aead(gt)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = byte(suite)
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, out[1:], plaintext, ad), nil
+}
+
+// Open decrypts the output of Seal. It fails if gt or ad differ from the ones
+// used by Seal or if the payload was modified.
+func Open(gt *bn256.GT, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, errors.New("symenc: empty payload")
+	}
+	aead, err := Suite(sealed[0]).aead(gt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < 1+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("symenc: payload too short")
+	}
+	nonce := sealed[1 : 1+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, sealed[1+aead.NonceSize():], ad)
+	if err != nil {
+		return nil, errors.New("symenc: authentication failed")
+	}
+	return plaintext, nil
+}
+
+// Deprecated: XOREncryptDecrypt repeats the key stream and has no integrity,
+// use Seal and Open.
 func XOREncryptDecrypt(data, key []byte) []byte {
 	result := make([]byte, len(data))
 	for i := range data {
@@ -17,14 +109,13 @@ func XOREncryptDecrypt(data, key []byte) []byte {
 	return result
 }
 
+// Deprecated: KDF hashes the non-canonical GT.String(), use DeriveKey.
 func KDF(gt *bn256.GT) []byte {
 	hash := sha256.New()
 	hash.Write([]byte(gt.String()))
 	hashBytes := hash.Sum(nil)
-	hashString := hex.EncodeToString(hashBytes)
 	password := hashBytes[0:16]
 	salt := hashBytes[16:]
-	fmt.Println(hashString, hex.EncodeToString(password), hex.EncodeToString(salt))
 	key := pbkdf2.Key(password, salt, 10000, 512, sha256.New)
 	return key
 }
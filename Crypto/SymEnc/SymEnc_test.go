@@ -0,0 +1,105 @@
+package SymEnc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/fentec-project/bn256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	_, gt, _ := bn256.RandomGT(rand.Reader)
+	_, other, _ := bn256.RandomGT(rand.Reader)
+	//Longer than the old 512-byte key stream
+	msg := make([]byte, 2000)
+	rand.Read(msg)
+	ad := []byte("Attr1 AND Attr2")
+
+	for _, suite := range []Suite{AES256GCM, ChaCha20Poly1305} {
+		sealed, err := Seal(gt, suite, msg, ad)
+		require.NoError(t, err)
+		plain, err := Open(gt, sealed, ad)
+		require.NoError(t, err)
+		require.Equal(t, msg, plain)
+
+		//Fresh nonces give different payloads for the same input
+		sealed2, _ := Seal(gt, suite, msg, ad)
+		require.NotEqual(t, sealed, sealed2)
+
+		//Wrong key, wrong associated data and any modification are rejected
+		_, err = Open(other, sealed, ad)
+		require.Error(t, err)
+		_, err = Open(gt, sealed, []byte("Attr1"))
+		require.Error(t, err)
+		sealed[len(sealed)/2] ^= 1
+		_, err = Open(gt, sealed, ad)
+		require.Error(t, err)
+		_, err = Open(gt, sealed[:10], ad)
+		require.Error(t, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	_, gt, _ := bn256.RandomGT(rand.Reader)
+	ad := []byte("Attr1 AND Attr2")
+	encrypt := func(msg []byte, suite Suite) []byte {
+		var out bytes.Buffer
+		w, err := NewEncryptWriter(&out, gt, suite, ad)
+		require.NoError(t, err)
+		//Write in odd-sized pieces so chunk boundaries fall inside writes
+		for len(msg) > 0 {
+			n := min(len(msg), 1000)
+			_, err := w.Write(msg[:n])
+			require.NoError(t, err)
+			msg = msg[n:]
+		}
+		require.NoError(t, w.Close())
+		return out.Bytes()
+	}
+	decrypt := func(stream []byte) ([]byte, error) {
+		r, err := NewDecryptReader(bytes.NewReader(stream), gt, ad)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 1, ChunkSize, 3*ChunkSize + 17} {
+		msg := make([]byte, size)
+		rand.Read(msg)
+		for _, suite := range []Suite{AES256GCM, ChaCha20Poly1305} {
+			plain, err := decrypt(encrypt(msg, suite))
+			require.NoError(t, err)
+			require.Equal(t, msg, plain)
+		}
+	}
+
+	msg := make([]byte, 3*ChunkSize+17)
+	rand.Read(msg)
+	stream := encrypt(msg, AES256GCM)
+	chunk := ChunkSize + 16
+	header := 1 + saltSize
+	//Truncation at a chunk boundary
+	_, err := decrypt(stream[:header+2*chunk])
+	require.Error(t, err)
+	//Dropping the final chunk entirely
+	_, err = decrypt(stream[:header+3*chunk])
+	require.Error(t, err)
+	//Swapping two chunks
+	swapped := append([]byte{}, stream...)
+	copy(swapped[header:], stream[header+chunk:header+2*chunk])
+	copy(swapped[header+chunk:], stream[header:header+chunk])
+	_, err = decrypt(swapped)
+	require.Error(t, err)
+	//Trailing data after the final chunk
+	_, err = decrypt(append(append([]byte{}, stream...), 0))
+	require.Error(t, err)
+	//Wrong associated data
+	r, err := NewDecryptReader(bytes.NewReader(stream), gt, []byte("Attr1"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.Error(t, err)
+}